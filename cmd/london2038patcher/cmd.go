@@ -1,25 +1,245 @@
 package main
 
 import (
+	"context"
+	"time"
+
 	"github.com/ricochhet/london2038patcher/cmd/london2038patcher/internal/patcher"
 	"github.com/ricochhet/london2038patcher/cmd/london2038patcher/internal/patchutil"
 	"github.com/ricochhet/london2038patcher/cmd/london2038patcher/internal/regutil"
 	"github.com/ricochhet/london2038patcher/pkg/logutil"
+	"github.com/ricochhet/london2038patcher/pkg/strutil"
 	"github.com/ricochhet/london2038patcher/pkg/timeutil"
 )
 
 // downloadCmd command.
-func downloadCmd(p *patcher.Context) error {
+func downloadCmd(ctx context.Context, p *patcher.Context) error {
 	return timeutil.Timer(func() error {
-		err := p.Get().Download()
+		err := p.Get().Download(ctx)
 		if err != nil {
 			logutil.Errorf(logutil.Get(), "Error downloading files: %v\n", err)
 		}
 
 		return err
-	}, "Download", func(_, elapsed string) {
-		logutil.Infof(logutil.Get(), "Took %s\n", elapsed)
-	})
+	}, "Download", took)
+}
+
+// checkCmd command.
+func checkCmd(ctx context.Context, p *patcher.Context) error {
+	return timeutil.Timer(func() error {
+		s, err := p.Get().Check(ctx)
+		if err != nil {
+			logutil.Errorf(logutil.Get(), "Error checking files: %v\n", err)
+			return err
+		}
+
+		return printStatus(s)
+	}, "Check", took)
+}
+
+// verifyCmd command.
+func verifyCmd(ctx context.Context, p *patcher.Context) error {
+	return timeutil.Timer(func() error {
+		s, err := p.Get().Verify(ctx)
+		if err != nil {
+			logutil.Errorf(logutil.Get(), "Error verifying files: %v\n", err)
+			return err
+		}
+
+		return printStatus(s)
+	}, "Verify", took)
+}
+
+// repairCmd command.
+func repairCmd(ctx context.Context, p *patcher.Context) error {
+	return timeutil.Timer(func() error {
+		s, err := p.Get().Repair(ctx)
+		if err != nil {
+			logutil.Errorf(logutil.Get(), "Error repairing files: %v\n", err)
+			return err
+		}
+
+		logutil.Infof(
+			logutil.Get(),
+			"Repaired %d missing and %d outdated files\n",
+			len(s.Missing),
+			len(s.Outdated),
+		)
+
+		return nil
+	}, "Repair", took)
+}
+
+// mirrorCmd command.
+func mirrorCmd(ctx context.Context, p *patcher.Context, a ...string) error {
+	return timeutil.Timer(func() error {
+		s, err := p.Get().Mirror(ctx, a[0])
+		if err != nil {
+			logutil.Errorf(logutil.Get(), "Error mirroring files: %v\n", err)
+			return err
+		}
+
+		logutil.Infof(
+			logutil.Get(),
+			"Mirrored snapshot %s (%d files, %s)\n",
+			s.Name,
+			s.Files,
+			strutil.Size(s.Size),
+		)
+
+		return nil
+	}, "Mirror", took)
+}
+
+// pruneCmd command.
+func pruneCmd(ctx context.Context, p *patcher.Context) error {
+	return timeutil.Timer(func() error {
+		remove := flags.Yes && !flags.DryRun
+
+		files, err := p.Get().Prune(ctx, strutil.Fields(flags.Protect, ","), remove)
+		if err != nil {
+			logutil.Errorf(logutil.Get(), "Error pruning files: %v\n", err)
+			return err
+		}
+
+		if remove {
+			logutil.Infof(logutil.Get(), "Removed %d untracked files\n", len(files))
+			return nil
+		}
+
+		for _, file := range files {
+			logutil.Infof(logutil.Get(), "Would remove: %s\n", file)
+		}
+
+		logutil.Infof(
+			logutil.Get(),
+			"%d untracked files, use -yes to remove them\n",
+			len(files),
+		)
+
+		return nil
+	}, "Prune", took)
+}
+
+// rollbackCmd command.
+func rollbackCmd(p *patcher.Context, a ...string) error {
+	return timeutil.Timer(func() error {
+		if len(a) == 0 {
+			backups, err := p.Get().Backups()
+			if err != nil {
+				logutil.Errorf(logutil.Get(), "Error listing backups: %v\n", err)
+				return err
+			}
+
+			for _, b := range backups {
+				logutil.Infof(logutil.Get(), "Backup: %s (%s)\n", b.Name, b.Created.Format(time.DateTime))
+			}
+
+			logutil.Infof(logutil.Get(), "%d backups, use rollback [NAME] to restore one\n", len(backups))
+
+			return nil
+		}
+
+		err := p.Get().Rollback(a[0])
+		if err != nil {
+			logutil.Errorf(logutil.Get(), "Error rolling back: %v\n", err)
+		}
+
+		return err
+	}, "Rollback", took)
+}
+
+// genKeyCmd command.
+func genKeyCmd(a ...string) error {
+	pub, err := patcher.GenerateKey(a[0])
+	if err != nil {
+		logutil.Errorf(logutil.Get(), "Error generating key: %v\n", err)
+		return err
+	}
+
+	logutil.Infof(logutil.Get(), "Public key: %s\n", pub)
+
+	return nil
+}
+
+// signManifestCmd command.
+func signManifestCmd(a ...string) error {
+	err := patcher.SignManifest(a[0], a[1])
+	if err != nil {
+		logutil.Errorf(logutil.Get(), "Error signing checksum file: %v\n", err)
+		return err
+	}
+
+	logutil.Infof(logutil.Get(), "Signed: %s\n", a[1])
+
+	return nil
+}
+
+// genManifestCmd command.
+func genManifestCmd(ctx context.Context, a ...string) error {
+	return timeutil.Timer(func() error {
+		rules, err := patcher.ReadRules(flags.NoDownloadRules)
+		if err != nil {
+			logutil.Errorf(logutil.Get(), "Error reading rules: %v\n", err)
+			return err
+		}
+
+		files, err := patcher.GenerateManifest(ctx, a[0], a[1], &patcher.ManifestOptions{
+			Include:    strutil.Fields(flags.Include, ","),
+			Exclude:    strutil.Fields(flags.Exclude, ","),
+			NoDownload: rules,
+		})
+		if err != nil {
+			logutil.Errorf(logutil.Get(), "Error generating checksum file: %v\n", err)
+			return err
+		}
+
+		logutil.Infof(logutil.Get(), "Wrote %d files to %s\n", len(files.Entries), a[1])
+
+		return nil
+	}, "GenManifest", took)
+}
+
+// serveCmd command.
+func serveCmd(ctx context.Context, a ...string) error {
+	s, err := patcher.NewServer(a[0], flags.ChecksumFile)
+	if err != nil {
+		logutil.Errorf(logutil.Get(), "Error loading files: %v\n", err)
+		return err
+	}
+
+	return s.ListenAndServe(ctx, flags.Addr)
+}
+
+// printStatus prints the status report, returning patcher.ErrUpdateNeeded if
+// any file is missing or outdated.
+func printStatus(s *patcher.Status) error {
+	for _, entry := range s.Missing {
+		logutil.Infof(logutil.Get(), "Missing: %s\n", entry.Name)
+	}
+
+	for _, entry := range s.Outdated {
+		logutil.Infof(logutil.Get(), "Outdated: %s\n", entry.Name)
+	}
+
+	for _, entry := range s.Current {
+		logutil.Debugf(logutil.Get(), "Up-to-date: %s\n", entry.Name)
+	}
+
+	logutil.Infof(
+		logutil.Get(),
+		"%d missing, %d outdated, %d up-to-date, %s to download\n",
+		len(s.Missing),
+		len(s.Outdated),
+		len(s.Current),
+		strutil.Size(s.Size()),
+	)
+
+	if s.UpdateNeeded() {
+		return patcher.ErrUpdateNeeded
+	}
+
+	return nil
 }
 
 // decodeCmd command.
@@ -31,9 +251,7 @@ func decodeCmd(a ...string) error {
 		}
 
 		return err
-	}, "Decode", func(_, elapsed string) {
-		logutil.Infof(logutil.Get(), "Took %s\n", elapsed)
-	})
+	}, "Decode", took)
 }
 
 // encodeCmd command.
@@ -45,65 +263,55 @@ func encodeCmd(a ...string) error {
 		}
 
 		return err
-	}, "Encode", func(_, elapsed string) {
-		logutil.Infof(logutil.Get(), "Took %s\n", elapsed)
-	})
+	}, "Encode", took)
 }
 
 // unpackCmd command.
-func unpackCmd(o patchutil.Options, a ...string) error {
+func unpackCmd(ctx context.Context, o patchutil.Options, a ...string) error {
 	return timeutil.Timer(func() error {
-		err := o.Unpack(a[0], a[1], a[2])
+		err := o.Unpack(ctx, a[0], a[1], a[2])
 		if err != nil {
 			logutil.Errorf(logutil.Get(), "Error unpacking patch: %v\n", err)
 		}
 
 		return err
-	}, "Unpack", func(_, elapsed string) {
-		logutil.Infof(logutil.Get(), "Took %s\n", elapsed)
-	})
+	}, "Unpack", took)
 }
 
 // packCmd command.
-func packCmd(o patchutil.Options, a ...string) error {
+func packCmd(ctx context.Context, o patchutil.Options, a ...string) error {
 	return timeutil.Timer(func() error {
-		err := o.Pack(a[0], a[1], a[2])
+		err := o.Pack(ctx, a[0], a[1], a[2])
 		if err != nil {
 			logutil.Errorf(logutil.Get(), "Error packing patch: %v\n", err)
 		}
 
 		return err
-	}, "Pack", func(_, elapsed string) {
-		logutil.Infof(logutil.Get(), "Took %s\n", elapsed)
-	})
+	}, "Pack", took)
 }
 
 // packWithIdxCmd command.
-func packWithIdxCmd(o patchutil.Options, a ...string) error {
+func packWithIdxCmd(ctx context.Context, o patchutil.Options, a ...string) error {
 	return timeutil.Timer(func() error {
-		err := o.PackWithIndex(a[0], a[1], a[2])
+		err := o.PackWithIndex(ctx, a[0], a[1], a[2])
 		if err != nil {
 			logutil.Errorf(logutil.Get(), "Error packing patch: %v\n", err)
 		}
 
 		return err
-	}, "PackWithIndex", func(_, elapsed string) {
-		logutil.Infof(logutil.Get(), "Took %s\n", elapsed)
-	})
+	}, "PackWithIndex", took)
 }
 
 // unpackFromFileCmd command.
-func unpackFromFileCmd(o patchutil.Options, a ...string) error {
+func unpackFromFileCmd(ctx context.Context, o patchutil.Options, a ...string) error {
 	return timeutil.Timer(func() error {
-		err := o.UnpackFromFile(a[0], a[1])
+		err := o.UnpackFromFile(ctx, a[0], a[1])
 		if err != nil {
 			logutil.Errorf(logutil.Get(), "Error unpacking patch: %v\n", err)
 		}
 
 		return err
-	}, "UnpackFromFile", func(_, elapsed string) {
-		logutil.Infof(logutil.Get(), "Took %s\n", elapsed)
-	})
+	}, "UnpackFromFile", took)
 }
 
 // regeditCmd command.
@@ -115,7 +323,5 @@ func regeditCmd(a ...string) error {
 		}
 
 		return err
-	}, "Regedit", func(_, elapsed string) {
-		logutil.Infof(logutil.Get(), "Took %s\n", elapsed)
-	})
+	}, "Regedit", took)
 }
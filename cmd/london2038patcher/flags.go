@@ -2,6 +2,7 @@ package main
 
 import (
 	"flag"
+	"time"
 
 	"github.com/ricochhet/london2038patcher/pkg/cmdutil"
 )
@@ -9,21 +10,85 @@ import (
 type Flags struct {
 	QuickEdit bool
 
-	ChecksumURL  string
-	PatchURL     string
-	ChecksumFile string
-	PatchDir     bool
-	Timeout      int
-	Locales      string
-	Archs        string
-	CRC32        bool
-	Debug        bool
+	ChecksumURL     string
+	PatchURL        string
+	ChecksumFile    string
+	MirrorStrategy  string
+	Addr            string
+	Protect         string
+	Yes             bool
+	DryRun          bool
+	KeepBackups     int
+	LimitRate       string
+	LimitRateFile   string
+	Proxy           string
+	CABundle        string
+	UserAgent       string
+	Headers         []string
+	PublicKey       string
+	Include         string
+	Exclude         string
+	NoDownloadRules string
+	PatchDir        bool
+	InstallDir      string
+	StrictPaths     bool
+	Force           bool
+	Report          string
+	KeepGoing       bool
+	Rehash          bool
+	Timeout         int
+	Jobs            int
+	Retries         int
+	RetryDelay      time.Duration
+	RetryMaxDelay   time.Duration
+	Progress        bool
+	Locales         string
+	Archs           string
+	CRC32           bool
+	Debug           bool
 }
 
 var (
 	flags = NewFlags()
 	cmds  = cmdutil.Commands{
 		{Usage: "patcher help", Desc: "Show this help"},
+		{
+			Usage: "patcher check",
+			Desc:  "Report missing and outdated files without downloading (exit code 2 if outdated)",
+		},
+		{
+			Usage: "patcher verify",
+			Desc:  "Verify files against the saved checksum file offline (exit code 2 if outdated)",
+		},
+		{Usage: "patcher repair", Desc: "Re-download files that fail verification"},
+		{
+			Usage: "patcher mirror [DIR]",
+			Desc:  "Archive the complete remote release into a snapshot directory",
+		},
+		{
+			Usage: "patcher prune",
+			Desc:  "List files not in the saved checksum file, removing them with -yes",
+		},
+		{
+			Usage: "patcher rollback [NAME]",
+			Desc:  "Restore a backup set, or list backup sets if no name is given",
+		},
+		{
+			Usage: "patcher genmanifest [DIR] [CHECKSUMS]",
+			Desc:  "Generate a checksum file from the files in a directory",
+		},
+		{
+			Usage: "patcher genkey [PRIVATE_KEY]",
+			Desc:  "Generate an ed25519 key pair for signing checksum files",
+		},
+		{
+			Usage: "patcher sign-manifest [PRIVATE_KEY] [CHECKSUMS]",
+			Desc:  "Sign a checksum file, writing [CHECKSUMS].sig",
+		},
+		{
+			Usage: "patcher serve [DIR]",
+			Desc:  "Serve the checksum file and patch files in a directory over HTTP",
+		},
 		{Usage: "patcher decodeidx [INDEX] [JSON]", Desc: "Decode an index file into a JSON file"},
 		{Usage: "patcher encodeidx [JSON] [INDEX]", Desc: "Decode a JSON file into an index"},
 		{
@@ -66,13 +131,13 @@ func registerFlags(fs *flag.FlagSet, f *Flags) {
 		&f.ChecksumURL,
 		"checksum-url",
 		"https://auth.london2038.com/patcher/checksums.xml",
-		"URL for checksum file",
+		"URL for checksum file, or a comma separated list of mirrors tried in order",
 	)
 	fs.StringVar(
 		&f.PatchURL,
 		"patch-url",
 		"https://auth.london2038.com/patcher/",
-		"URL for patch files",
+		"URL for patch files, or a comma separated list of mirrors",
 	)
 	fs.StringVar(
 		&f.ChecksumFile,
@@ -80,8 +145,78 @@ func registerFlags(fs *flag.FlagSet, f *Flags) {
 		"checksums.xml",
 		"Path to save checksum file to",
 	)
+	fs.StringVar(
+		&f.MirrorStrategy,
+		"mirror-strategy",
+		"ordered",
+		"Set patch mirror order: ordered or fastest, checksum mirrors are always tried in order",
+	)
+	fs.StringVar(&f.Addr, "addr", ":8080", "Set listen address for serve")
+	fs.StringVar(
+		&f.Protect,
+		"protect",
+		"*.ini,*.cfg,*.log,Screenshots,Save,Saves",
+		"Comma separated glob patterns of files prune never removes",
+	)
+	fs.BoolVar(&f.Yes, "yes", false, "Confirm removal of files")
+	fs.BoolVar(&f.DryRun, "dry-run", false, "Print what would be changed without changing anything")
+	fs.IntVar(&f.KeepBackups, "keep-backups", 3, "Set number of backup sets to keep, 0 disables backups")
 	fs.BoolVar(&f.PatchDir, "patch-dir", false, "Use patch directory for files")
+	fs.BoolVar(
+		&f.StrictPaths,
+		"strict-paths",
+		true,
+		"Fail unpacking on unsafe file names in the index, or skip and report them if false",
+	)
+	fs.BoolVar(&f.Force, "force", false, "Skip the free disk space check before downloading or unpacking")
+	fs.BoolVar(
+		&f.KeepGoing,
+		"keep-going",
+		false,
+		"Continue with the other files if one fails to download or unpack, and report all failures at the end",
+	)
+	fs.BoolVar(&f.Rehash, "rehash", false, "Hash every file instead of trusting the hash cache")
+	fs.StringVar(&f.Report, "report", "", "Write a JSON report of the run to this path")
+	fs.StringVar(&f.InstallDir, "install-dir", "", "Install files into this directory instead of the working directory")
 	fs.IntVar(&f.Timeout, "timeout", 0, "Set download timeout")
+	fs.IntVar(&f.Jobs, "jobs", 4, "Set number of concurrent downloads")
+	fs.IntVar(&f.Retries, "retries", 3, "Set number of retries for failed downloads")
+	fs.DurationVar(&f.RetryDelay, "retry-delay", time.Second, "Set base delay between retries")
+	fs.DurationVar(
+		&f.RetryMaxDelay,
+		"retry-max-delay",
+		30*time.Second,
+		"Set maximum delay between retries, including delays requested by Retry-After",
+	)
+	fs.StringVar(
+		&f.PublicKey,
+		"public-key",
+		"",
+		"Verify checksums.xml.sig with a base64 ed25519 public key, or asset:[NAME] for an embedded key",
+	)
+	fs.StringVar(&f.Include, "include", "", "Comma separated glob patterns of files genmanifest lists")
+	fs.StringVar(&f.Exclude, "exclude", "", "Comma separated glob patterns of files genmanifest skips")
+	fs.StringVar(
+		&f.NoDownloadRules,
+		"no-download-rules",
+		"",
+		"File of glob patterns, one per line, genmanifest marks download=\"false\"",
+	)
+	fs.StringVar(&f.Proxy, "proxy", "", "Set proxy URL, defaults to the HTTP(S)_PROXY environment")
+	fs.StringVar(&f.CABundle, "ca-bundle", "", "Trust CA certificates from a PEM file")
+	fs.StringVar(&f.UserAgent, "user-agent", "London2038Patcher", "Set User-Agent header")
+	fs.Func("header", "Add a request header as \"Key: Value\" (repeatable)", func(s string) error {
+		f.Headers = append(f.Headers, s)
+		return nil
+	})
+	fs.StringVar(&f.LimitRate, "limit-rate", "", "Limit total download rate per second, e.g. 2M")
+	fs.StringVar(
+		&f.LimitRateFile,
+		"limit-rate-file",
+		"",
+		"Read the download rate limit from a file, reloading it when it changes",
+	)
+	fs.BoolVar(&f.Progress, "progress", true, "Show download progress (terminal only)")
 	fs.StringVar(&f.Locales, "locales", "en", "Set locale code for un/packing")
 	fs.StringVar(&f.Archs, "archs", "x64,x86", "Set architectures for un/packing")
 	fs.BoolVar(&f.CRC32, "crc32", false, "Hash files with CRC32 when packing files with index")
@@ -0,0 +1,321 @@
+package patcher
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ricochhet/london2038patcher/pkg/errutil"
+	"github.com/ricochhet/london2038patcher/pkg/fsutil"
+	"github.com/ricochhet/london2038patcher/pkg/logutil"
+	"github.com/ricochhet/london2038patcher/pkg/pathutil"
+	"github.com/ricochhet/london2038patcher/pkg/xmlutil"
+)
+
+const backupRoot = "London2038Patcher/backups"
+
+type Backup struct {
+	Name    string
+	Created time.Time
+}
+
+// Backups returns the backup sets, newest first.
+func (p *Patcher) Backups() ([]Backup, error) {
+	dirs, err := os.ReadDir(p.backupRoot())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, errutil.New("os.ReadDir", err)
+	}
+
+	var backups []Backup
+
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+
+		info, err := os.Stat(filepath.Join(p.backupRoot(), d.Name(), filepath.Base(p.ChecksumFile)))
+		if err != nil {
+			continue
+		}
+
+		backups = append(backups, Backup{Name: d.Name(), Created: info.ModTime()})
+	}
+
+	slices.SortFunc(backups, func(a, b Backup) int {
+		return b.Created.Compare(a.Created)
+	})
+
+	return backups, nil
+}
+
+// Rollback removes the files added since the named backup set was taken, restores
+// the files and checksum file of the set, then removes the set.
+func (p *Patcher) Rollback(name string) error {
+	dir, err := fsutil.SafeJoin(p.backupRoot(), name)
+	if err != nil {
+		return errutil.New("fsutil.SafeJoin", err)
+	}
+
+	manifest := filepath.Join(dir, filepath.Base(p.ChecksumFile))
+
+	if !fsutil.Exists(manifest) {
+		return errutil.WithFramef("backup set does not exist: %s", name)
+	}
+
+	added, err := p.added(manifest)
+	if err != nil {
+		return errutil.New("p.added", err)
+	}
+
+	// Files the set holds existed before the update, so they are restored below.
+	for _, rel := range added {
+		path, err := fsutil.SafeJoin(p.InstallDir, rel)
+		if err != nil {
+			return errutil.New("fsutil.SafeJoin", err)
+		}
+
+		logutil.Infof(logutil.Get(), "Removing: %s\n", rel)
+
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errutil.New("os.Remove", err)
+		}
+
+		removeEmptyDirs(p.InstallDir, filepath.Dir(path))
+	}
+
+	err = filepath.WalkDir(dir, func(target string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return errutil.WithFrame(err)
+		}
+
+		if d.IsDir() || target == manifest {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, target)
+		if err != nil {
+			return errutil.New("filepath.Rel", err)
+		}
+
+		logutil.Infof(logutil.Get(), "Restoring: %s\n", rel)
+
+		path := filepath.Join(p.InstallDir, rel)
+		if err := fsutil.Ensure(path); err != nil {
+			return errutil.New("fsutil.Ensure", err)
+		}
+
+		return os.Rename(target, path)
+	})
+	if err != nil {
+		return errutil.New("filepath.WalkDir", err)
+	}
+
+	data, err := fsutil.Read(manifest)
+	if err != nil {
+		return errutil.New("fsutil.Read", err)
+	}
+
+	if err := fsutil.Write(p.ChecksumFile, data); err != nil {
+		return errutil.New("fsutil.Write", err)
+	}
+
+	if err := fsutil.Write(p.installedPath(), data); err != nil {
+		return errutil.New("fsutil.Write", err)
+	}
+
+	// The state belongs to the replaced checksum file, so the next download fetches
+	// the checksum file again and checks every file.
+	if err := os.Remove(p.statePath()); err != nil && !os.IsNotExist(err) {
+		return errutil.New("os.Remove", err)
+	}
+
+	return os.RemoveAll(dir)
+}
+
+// prepareBackup selects the backup set for files replaced by this update, named by
+// the CRC32 of the checksum file of the last completed install, and saves that
+// checksum file in it.
+func (p *Patcher) prepareBackup() error {
+	if p.KeepBackups <= 0 || p.UsePatchDir {
+		return nil
+	}
+
+	installed := p.installed()
+	if installed == "" {
+		return nil
+	}
+
+	prev, err := xmlutil.ReadAndUnmarshal[Files](installed)
+	if err != nil {
+		return errutil.New("xmlutil.ReadAndUnmarshal", err)
+	}
+
+	p.backupDir = filepath.Join(p.backupRoot(), path.Base(patchDirName(prev)))
+
+	manifest := filepath.Join(p.backupDir, filepath.Base(p.ChecksumFile))
+	if fsutil.Exists(manifest) {
+		return nil
+	}
+
+	data, err := fsutil.Read(installed)
+	if err != nil {
+		return errutil.New("fsutil.Read", err)
+	}
+
+	return fsutil.Write(manifest, data)
+}
+
+// added returns the relative paths of the files listed in the checksum file of the
+// current install but not in the checksum file at manifest.
+func (p *Patcher) added(manifest string) ([]string, error) {
+	installed := p.installed()
+	if installed == "" {
+		return nil, nil
+	}
+
+	prev, err := readFiles(manifest)
+	if err != nil {
+		return nil, errutil.New("readFiles", err)
+	}
+
+	cur, err := readFiles(installed)
+	if err != nil {
+		return nil, errutil.New("readFiles", err)
+	}
+
+	listed := make(map[string]struct{}, len(prev.Entries))
+	for _, entry := range prev.Entries {
+		listed[pruneKey(entry.Name)] = struct{}{}
+	}
+
+	var added []string
+
+	for _, entry := range cur.download() {
+		if _, ok := listed[pruneKey(entry.Name)]; ok {
+			continue
+		}
+
+		rel, err := pathutil.SafeRel(entry.Name)
+		if err != nil {
+			return nil, errutil.New("pathutil.SafeRel", err)
+		}
+
+		added = append(added, rel)
+	}
+
+	return added, nil
+}
+
+// removeEmptyDirs removes dir and its parents below root while they are empty.
+func removeEmptyDirs(root, dir string) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return
+	}
+
+	for dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)) {
+		if os.Remove(dir) != nil {
+			return
+		}
+
+		dir = filepath.Dir(dir)
+	}
+}
+
+// installed returns the path of the checksum file of the last completed install,
+// or an empty string if it is not known.
+func (p *Patcher) installed() string {
+	if fsutil.Exists(p.installedPath()) {
+		return p.installedPath()
+	}
+
+	// Installs from before the installed checksum file was kept only match the
+	// saved checksum file if the last download completed.
+	if fsutil.Exists(p.ChecksumFile) && p.readState().Current {
+		return p.ChecksumFile
+	}
+
+	return ""
+}
+
+// saveInstalled keeps a copy of the checksum file as the checksum file of the
+// completed install.
+func (p *Patcher) saveInstalled() error {
+	data, err := fsutil.Read(p.ChecksumFile)
+	if err != nil {
+		return errutil.New("fsutil.Read", err)
+	}
+
+	return fsutil.Write(p.installedPath(), data)
+}
+
+// installedPath returns the path of the checksum file of the last completed install.
+func (p *Patcher) installedPath() string {
+	return p.ChecksumFile + ".installed"
+}
+
+// backup links the file at path into the backup set, keeping any copy already in it.
+// The file itself stays in place until the download replacing it is verified.
+func (p *Patcher) backup(path string) error {
+	if p.backupDir == "" || !fsutil.Exists(path) {
+		return nil
+	}
+
+	root, err := filepath.Abs(p.InstallDir)
+	if err != nil {
+		return errutil.New("filepath.Abs", err)
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return errutil.New("filepath.Rel", err)
+	}
+
+	target := filepath.Join(p.backupDir, rel)
+	if fsutil.Exists(target) {
+		return nil
+	}
+
+	if err := fsutil.Ensure(target); err != nil {
+		return errutil.New("fsutil.Ensure", err)
+	}
+
+	logutil.Debugf(logutil.Get(), "Backing up: %s to %s\n", path, target)
+
+	return fsutil.LinkOrCopy(path, target)
+}
+
+// pruneBackups removes all but the newest KeepBackups backup sets.
+func (p *Patcher) pruneBackups() error {
+	if p.KeepBackups <= 0 {
+		return nil
+	}
+
+	backups, err := p.Backups()
+	if err != nil {
+		return errutil.New("p.Backups", err)
+	}
+
+	for _, b := range backups[min(p.KeepBackups, len(backups)):] {
+		logutil.Infof(logutil.Get(), "Removing backup: %s\n", b.Name)
+
+		if err := os.RemoveAll(filepath.Join(p.backupRoot(), b.Name)); err != nil {
+			return errutil.New("os.RemoveAll", err)
+		}
+	}
+
+	return nil
+}
+
+// backupRoot returns the directory of the backup sets in the install directory.
+func (p *Patcher) backupRoot() string {
+	return filepath.Join(p.InstallDir, backupRoot)
+}
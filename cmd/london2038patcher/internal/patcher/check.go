@@ -0,0 +1,203 @@
+package patcher
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/ricochhet/london2038patcher/pkg/errutil"
+	"github.com/ricochhet/london2038patcher/pkg/fsutil"
+)
+
+type Status struct {
+	Missing  []FileEntry
+	Outdated []FileEntry
+	Current  []FileEntry
+}
+
+var ErrUpdateNeeded = errors.New("update needed")
+
+// Check downloads the checksums and reports which files are missing, outdated or
+// up-to-date without downloading any files.
+func (p *Patcher) Check(ctx context.Context) (*Status, error) {
+	p.loadHashes()
+	defer p.saveHashes()
+
+	p.sortMirrors(ctx)
+
+	files, err := p.downloadChecksums(ctx)
+	if err != nil {
+		return nil, errutil.New("p.downloadChecksums", err)
+	}
+
+	if p.upToDate {
+		return &Status{Current: files.download()}, nil
+	}
+
+	if p.UsePatchDir {
+		p.PatchDir = patchDirName(files)
+	}
+
+	return p.checkStatus(ctx, files)
+}
+
+// Verify reports which files are missing, outdated or up-to-date using the
+// previously saved checksum file, without any network access.
+func (p *Patcher) Verify(ctx context.Context) (*Status, error) {
+	p.loadHashes()
+	defer p.saveHashes()
+
+	if err := p.verifySignature(); err != nil {
+		return nil, errutil.New("p.verifySignature", err)
+	}
+
+	files, err := readFiles(p.ChecksumFile)
+	if err != nil {
+		return nil, errutil.New("readFiles", err)
+	}
+
+	if p.UsePatchDir {
+		p.PatchDir = patchDirName(files)
+	}
+
+	return p.checkStatus(ctx, files)
+}
+
+// Repair verifies the files using the previously saved checksum file and
+// downloads only the files that are missing or outdated.
+func (p *Patcher) Repair(ctx context.Context) (*Status, error) {
+	s, err := p.Verify(ctx)
+	if err != nil {
+		return nil, errutil.New("p.Verify", err)
+	}
+
+	if !s.UpdateNeeded() {
+		return s, nil
+	}
+
+	defer p.saveHashes()
+
+	files := &Files{Entries: slices.Concat(s.Missing, s.Outdated)}
+
+	p.sortMirrors(ctx)
+	p.startProgress(files)
+
+	// The files were just hashed, so only the missing and outdated ones are queued.
+	if err := p.downloadStatus(ctx, &Status{Missing: s.Missing, Outdated: s.Outdated}); err != nil {
+		return s, errutil.New("p.downloadStatus", err)
+	}
+
+	if err := p.markCurrent(); err != nil {
+		return s, errutil.New("p.markCurrent", err)
+	}
+
+	if err := p.saveInstalled(); err != nil {
+		return s, errutil.New("p.saveInstalled", err)
+	}
+
+	return s, nil
+}
+
+// checkStatus returns the status of the files, marking the install outdated if any
+// file is missing or outdated.
+func (p *Patcher) checkStatus(ctx context.Context, files *Files) (*Status, error) {
+	s, err := p.status(ctx, files)
+	if err != nil {
+		return nil, errutil.New("p.status", err)
+	}
+
+	if s.UpdateNeeded() {
+		if err := p.markOutdated(); err != nil {
+			return s, errutil.New("p.markOutdated", err)
+		}
+	}
+
+	return s, nil
+}
+
+// Size returns the combined size of the files that need to be downloaded.
+func (s *Status) Size() int64 {
+	var n int64
+
+	for _, entry := range slices.Concat(s.Missing, s.Outdated) {
+		n += entry.checksum().Size
+	}
+
+	return n
+}
+
+// UpdateNeeded returns true if any file is missing or outdated.
+func (s *Status) UpdateNeeded() bool {
+	return len(s.Missing) > 0 || len(s.Outdated) > 0
+}
+
+// status compares the files against the local files, hashing up to p.Jobs files at
+// once, and stops early if ctx is canceled.
+func (p *Patcher) status(ctx context.Context, files *Files) (*Status, error) {
+	type result int
+
+	const (
+		missing result = iota
+		outdated
+		current
+	)
+
+	var wg sync.WaitGroup
+
+	entries := files.download()
+	results := make([]result, len(entries))
+	indices := make(chan int)
+
+	for range p.jobs() {
+		wg.Go(func() {
+			for i := range indices {
+				if ctx.Err() != nil {
+					continue
+				}
+
+				path, err := p.path(entries[i])
+
+				switch {
+				case err != nil || !fsutil.Exists(path):
+					results[i] = missing
+				case !p.hashes.Validate(path, entries[i].Hash, md5.New()):
+					results[i] = outdated
+				default:
+					results[i] = current
+				}
+			}
+		})
+	}
+
+	for i := range entries {
+		if ctx.Err() != nil {
+			break
+		}
+
+		indices <- i
+	}
+
+	close(indices)
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return nil, errutil.New("ctx.Err", context.Cause(ctx))
+	}
+
+	var s Status
+
+	for i, entry := range entries {
+		switch results[i] {
+		case missing:
+			s.Missing = append(s.Missing, entry)
+		case outdated:
+			s.Outdated = append(s.Outdated, entry)
+		case current:
+			s.Current = append(s.Current, entry)
+		}
+	}
+
+	return &s, nil
+}
@@ -0,0 +1,133 @@
+package patcher
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ricochhet/london2038patcher/pkg/cryptoutil"
+	"github.com/ricochhet/london2038patcher/pkg/errutil"
+	"github.com/ricochhet/london2038patcher/pkg/fsutil"
+	"github.com/ricochhet/london2038patcher/pkg/logutil"
+	"github.com/ricochhet/london2038patcher/pkg/pathutil"
+	"github.com/ricochhet/london2038patcher/pkg/xmlutil"
+)
+
+// ManifestOptions controls which files GenerateManifest lists.
+type ManifestOptions struct {
+	Include    []string // Only files matching these patterns are listed, all files if empty.
+	Exclude    []string // Files matching these patterns are not listed.
+	NoDownload []string // Files matching these patterns are listed with download="false".
+}
+
+// GenerateManifest walks dir and writes a checksum file listing every file with
+// its MD5 hash and size to output, stopping if ctx is canceled.
+func GenerateManifest(ctx context.Context, dir, output string, opts *ManifestOptions) (*Files, error) {
+	abs, err := filepath.Abs(output)
+	if err != nil {
+		return nil, errutil.New("filepath.Abs", err)
+	}
+
+	files := &Files{}
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return errutil.WithFrame(err)
+		}
+
+		if ctx.Err() != nil {
+			return errutil.New("ctx.Err", context.Cause(ctx))
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		if p, err := filepath.Abs(path); err == nil && (p == abs || p == signaturePath(abs)) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return errutil.New("filepath.Rel", err)
+		}
+
+		rel = filepath.ToSlash(rel)
+
+		if (len(opts.Include) > 0 && !pathutil.Match(opts.Include, rel)) ||
+			pathutil.Match(opts.Exclude, rel) {
+			return nil
+		}
+
+		entry, err := manifestEntry(path, rel, opts)
+		if err != nil {
+			return errutil.New("manifestEntry", err)
+		}
+
+		logutil.Infof(logutil.Get(), "Adding: %s (%s bytes)\n", entry.Name, entry.Filesize)
+
+		files.Entries = append(files.Entries, *entry)
+
+		return nil
+	})
+	if err != nil {
+		return nil, errutil.New("filepath.WalkDir", err)
+	}
+
+	if _, err := xmlutil.MarshalAndWrite(output, files); err != nil {
+		return nil, errutil.New("xmlutil.MarshalAndWrite", err)
+	}
+
+	return files, nil
+}
+
+// ReadRules reads glob patterns from the file at path, one per line, ignoring
+// empty lines and lines starting with "#".
+func ReadRules(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := fsutil.Read(path)
+	if err != nil {
+		return nil, errutil.New("fsutil.Read", err)
+	}
+
+	var rules []string
+
+	for line := range strings.Lines(string(data)) {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			rules = append(rules, line)
+		}
+	}
+
+	return rules, nil
+}
+
+// manifestEntry returns the file entry for the file at path.
+func manifestEntry(path, rel string, opts *ManifestOptions) (*FileEntry, error) {
+	hash, err := cryptoutil.MD5(path)
+	if err != nil {
+		return nil, errutil.New("cryptoutil.MD5", err)
+	}
+
+	size, err := fsutil.Size(path)
+	if err != nil {
+		return nil, errutil.New("fsutil.Size", err)
+	}
+
+	download := "true"
+	if pathutil.Match(opts.NoDownload, rel) {
+		download = "false"
+	}
+
+	return &FileEntry{
+		Name:     strings.ReplaceAll(rel, "/", "\\"),
+		Hash:     strings.ToUpper(hash),
+		Filesize: strconv.FormatInt(size, 10),
+		Download: download,
+	}, nil
+}
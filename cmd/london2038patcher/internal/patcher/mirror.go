@@ -0,0 +1,140 @@
+package patcher
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ricochhet/london2038patcher/pkg/errutil"
+	"github.com/ricochhet/london2038patcher/pkg/fsutil"
+	"github.com/ricochhet/london2038patcher/pkg/jsonutil"
+)
+
+type Snapshot struct {
+	Name     string `json:"name"`
+	Captured string `json:"captured"`
+	Updated  string `json:"updated"`
+	Files    int    `json:"files"`
+	Size     int64  `json:"size"`
+}
+
+type Snapshots struct {
+	Snapshots []Snapshot `json:"snapshots"`
+}
+
+// Mirror downloads the checksum file and every file it lists, including files not
+// marked for download, into a snapshot directory named by the CRC32 of the release.
+// Files already present in the snapshot are skipped, and the snapshot is recorded
+// in the snapshot index of dir.
+func (p *Patcher) Mirror(ctx context.Context, dir string) (*Snapshot, error) {
+	p.sortMirrors(ctx)
+
+	p.ChecksumFile = filepath.Join(dir, filepath.Base(p.ChecksumFile))
+
+	p.loadHashes()
+	defer p.saveHashes()
+
+	files, err := p.downloadChecksums(ctx)
+	if err != nil {
+		return nil, errutil.New("p.downloadChecksums", err)
+	}
+
+	name := snapshotName(files)
+
+	p.InstallDir = dir
+	p.UsePatchDir = true
+	p.PatchDir = name
+
+	manifests := []string{p.ChecksumFile}
+	if p.PublicKey != nil {
+		manifests = append(manifests, signaturePath(p.ChecksumFile))
+	}
+
+	for _, manifest := range manifests {
+		data, err := fsutil.Read(manifest)
+		if err != nil {
+			return nil, errutil.New("fsutil.Read", err)
+		}
+
+		if err := fsutil.Write(filepath.Join(dir, name, filepath.Base(manifest)), data); err != nil {
+			return nil, errutil.New("fsutil.Write", err)
+		}
+	}
+
+	all := &Files{Entries: make([]FileEntry, 0, len(files.Entries))}
+	for _, entry := range files.Entries {
+		entry.Download = "true"
+		all.Entries = append(all.Entries, entry)
+	}
+
+	p.startProgress(all)
+
+	if err := p.downloadFiles(ctx, all); err != nil {
+		return nil, errutil.New("p.downloadFiles", err)
+	}
+
+	s := Snapshot{
+		Name:    name,
+		Updated: time.Now().Format(time.RFC3339),
+		Files:   len(all.Entries),
+		Size:    all.size(),
+	}
+
+	if err := addSnapshot(filepath.Join(dir, "snapshots.json"), &s); err != nil {
+		return nil, errutil.New("addSnapshot", err)
+	}
+
+	return &s, nil
+}
+
+// addSnapshot adds or updates the snapshot in the snapshot index at path.
+func addSnapshot(path string, s *Snapshot) error {
+	index := &Snapshots{}
+
+	if fsutil.Exists(path) {
+		var err error
+
+		index, err = jsonutil.ReadAndUnmarshal[Snapshots](path)
+		if err != nil {
+			return errutil.New("jsonutil.ReadAndUnmarshal", err)
+		}
+	}
+
+	s.Captured = s.Updated
+
+	found := false
+
+	for i := range index.Snapshots {
+		if index.Snapshots[i].Name == s.Name {
+			s.Captured = index.Snapshots[i].Captured
+			index.Snapshots[i] = *s
+			found = true
+		}
+	}
+
+	if !found {
+		index.Snapshots = append(index.Snapshots, *s)
+	}
+
+	if _, err := jsonutil.MarshalAndWrite(path, index); err != nil {
+		return errutil.New("jsonutil.MarshalAndWrite", err)
+	}
+
+	return nil
+}
+
+// snapshotName returns the snapshot folder name using CRC32 of the hashes of every
+// file, including files not marked for download, so releases that differ only in
+// those files get their own snapshot.
+func snapshotName(files *Files) string {
+	var sb strings.Builder
+
+	for _, f := range files.Entries {
+		sb.WriteString(f.Hash)
+	}
+
+	return fmt.Sprintf("%08X", crc32.ChecksumIEEE([]byte(sb.String())))
+}
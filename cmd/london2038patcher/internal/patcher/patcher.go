@@ -2,32 +2,57 @@ package patcher
 
 import (
 	"context"
-	"crypto/md5"
+	"crypto/ed25519"
+	"errors"
 	"fmt"
 	"hash/crc32"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ricochhet/london2038patcher/pkg/dlutil"
 	"github.com/ricochhet/london2038patcher/pkg/errutil"
 	"github.com/ricochhet/london2038patcher/pkg/fsutil"
 	"github.com/ricochhet/london2038patcher/pkg/logutil"
+	"github.com/ricochhet/london2038patcher/pkg/pathutil"
 	"github.com/ricochhet/london2038patcher/pkg/xmlutil"
+	"github.com/sasha-s/go-deadlock"
 )
 
 type Patcher struct {
-	HTTPClient dlutil.HTTPClient
+	Source dlutil.Source // Downloads from HTTP URLs, file:// URLs and plain paths.
 
-	ChecksumURL  string
-	PatchURL     string
-	ChecksumFile string
+	ChecksumURLs   []string
+	PatchURLs      []string
+	ChecksumFile   string
+	MirrorStrategy dlutil.MirrorStrategy
+	PublicKey      ed25519.PublicKey // Verifies the checksum file signature if set.
 
 	HellgateCUKey string
 	HellgateKey   string
 
+	InstallDir  string // Files are installed relative to this directory, the working directory if empty.
 	UsePatchDir bool
 	PatchDir    string
+
+	Jobs         int
+	ShowProgress bool
+	KeepBackups  int
+	Force        bool    // Skips the free disk space check.
+	KeepGoing    bool    // Continues with the other files if a file fails to download.
+	Rehash       bool    // Hashes every file instead of trusting the hash cache.
+	Report       *Report // Records the result of every file download if set.
+
+	progress  *logutil.Progress
+	hashes    *fsutil.HashCache
+	backupDir string
+	state     *checksumState
+	upToDate  bool
 }
 
 type FileEntry struct {
@@ -42,14 +67,28 @@ type Files struct {
 }
 
 // Download downloads the checksums and files for London 2038.
-func (p *Patcher) Download() error {
-	files, err := p.downloadChecksums()
+func (p *Patcher) Download(ctx context.Context) error {
+	p.loadHashes()
+	defer p.saveHashes()
+
+	p.sortMirrors(ctx)
+
+	if err := p.prepareBackup(); err != nil {
+		return errutil.New("p.prepareBackup", err)
+	}
+
+	files, err := p.downloadChecksums(ctx)
 	if err != nil {
 		return errutil.New("p.downloadChecksums", err)
 	}
 
+	if p.upToDate {
+		logutil.Infof(logutil.Get(), "Skipping: %s not modified and install is up-to-date\n", p.ChecksumFile)
+		return nil
+	}
+
 	if p.UsePatchDir {
-		path, err := patchDir(files)
+		path, err := patchDir(p.InstallDir, files)
 		if err != nil {
 			return errutil.New("patchDir", err)
 		}
@@ -57,66 +96,389 @@ func (p *Patcher) Download() error {
 		p.PatchDir = path
 	}
 
-	if err := p.downloadFiles(files); err != nil {
+	p.startProgress(files)
+
+	if err := p.downloadFiles(ctx, files); err != nil {
 		return errutil.New("p.downloadFiles", err)
 	}
 
+	p.state.Current = true
+	p.state.UsePatchDir = p.UsePatchDir
+
+	if err := p.writeState(p.state); err != nil {
+		return errutil.New("p.writeState", err)
+	}
+
+	if err := p.saveInstalled(); err != nil {
+		return errutil.New("p.saveInstalled", err)
+	}
+
+	if err := p.pruneBackups(); err != nil {
+		return errutil.New("p.pruneBackups", err)
+	}
+
 	return nil
 }
 
 // downloadChecksums downloads the checksum file and unmarshals it into a Files struct.
-func (p *Patcher) downloadChecksums() (*Files, error) {
-	if err := p.HTTPClient.Download(
-		context.Background(),
+// The checksum file is only downloaded if it changed since the last download, and
+// p.upToDate is set if it did not change and the install matched it.
+func (p *Patcher) downloadChecksums(ctx context.Context) (*Files, error) {
+	p.state = p.readState()
+
+	if err := fsutil.Ensure(p.ChecksumFile); err != nil {
+		return &Files{}, errutil.New("fsutil.Ensure", err)
+	}
+
+	cond := &dlutil.Conditional{ETag: p.state.ETag, LastModified: p.state.LastModified}
+	prev, _ := os.ReadFile(p.ChecksumFile)
+
+	if err := dlutil.DownloadMirrorsConditional(
+		ctx,
+		p.Source,
 		p.ChecksumFile,
-		p.ChecksumURL,
+		p.ChecksumURLs,
+		cond,
 	); err != nil {
-		return &Files{}, errutil.New("p.HTTPClient.Download", err)
+		return &Files{}, errutil.New("dlutil.DownloadMirrorsConditional", err)
+	}
+
+	if err := p.downloadSignature(ctx); err != nil {
+		restore(p.ChecksumFile, prev)
+		return &Files{}, errutil.New("p.downloadSignature", err)
 	}
 
-	files, err := xmlutil.ReadAndUnmarshal[Files](p.ChecksumFile)
+	p.upToDate = cond.NotModified && p.state.Current && p.state.UsePatchDir == p.UsePatchDir && !p.Rehash
+
+	if !cond.NotModified {
+		p.state = &checksumState{ETag: cond.ETag, LastModified: cond.LastModified}
+
+		if err := p.writeState(p.state); err != nil {
+			return &Files{}, errutil.New("p.writeState", err)
+		}
+	}
+
+	files, err := readFiles(p.ChecksumFile)
 	if err != nil {
-		return &Files{}, errutil.New("xmlutil.ReadAndUnmarshal", err)
+		restore(p.ChecksumFile, prev)
+		return &Files{}, errutil.New("readFiles", err)
+	}
+
+	if p.upToDate && !p.unchanged(files) {
+		p.upToDate = false
 	}
 
 	return files, nil
 }
 
-// downloadFiles processes the files by downloading them to the correct directory.
-func (p *Patcher) downloadFiles(files *Files) error {
-	for _, entry := range files.Entries {
-		if strings.ToLower(entry.Download) != "true" {
-			continue
+// unchanged returns true if every file to download exists and did not change since
+// it was last hashed, without hashing any file.
+func (p *Patcher) unchanged(files *Files) bool {
+	if p.UsePatchDir {
+		prev := p.PatchDir
+		defer func() { p.PatchDir = prev }()
+
+		p.PatchDir = patchDirName(files)
+	}
+
+	for _, entry := range files.download() {
+		path, err := p.path(entry)
+		if err != nil || !p.hashes.Unchanged(path, entry.Hash) {
+			return false
 		}
+	}
+
+	return true
+}
 
-		path := entry.Name
-		if p.UsePatchDir {
-			path = filepath.Join(p.PatchDir, entry.Name)
+// startProgress enables progress reporting for the files if ShowProgress is set.
+func (p *Patcher) startProgress(files *Files) {
+	if !p.ShowProgress {
+		return
+	}
+
+	p.progress = logutil.NewProgress(files.size(), time.Second)
+	p.Source.SetProgress(p.progress)
+}
+
+// downloadFiles processes the files by downloading them to the correct directory,
+// skipping files that are already up-to-date.
+func (p *Patcher) downloadFiles(ctx context.Context, files *Files) error {
+	s, err := p.status(ctx, files)
+	if err != nil {
+		return errutil.New("p.status", err)
+	}
+
+	return p.downloadStatus(ctx, s)
+}
+
+// downloadStatus downloads the missing and outdated files of s. Files are
+// downloaded concurrently by up to p.Jobs workers, and the first error or
+// cancellation of ctx cancels the remaining downloads. With p.KeepGoing, files
+// that fail are skipped and returned together as one error after all other files
+// are downloaded.
+func (p *Patcher) downloadStatus(ctx context.Context, s *Status) error {
+	if err := p.checkSpace(s); err != nil {
+		return errutil.New("p.checkSpace", err)
+	}
+
+	p.skip(s.Current)
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	entries := make(chan FileEntry)
+
+	var (
+		wg         sync.WaitGroup
+		downloaded atomic.Int64
+		mu         deadlock.Mutex
+		failed     []error
+	)
+
+	for range p.jobs() {
+		wg.Go(func() {
+			for entry := range entries {
+				if ctx.Err() != nil {
+					continue
+				}
+
+				start := time.Now()
+				err := p.downloadFile(ctx, entry)
+				p.Report.add(entry, err == nil, time.Since(start), err)
+
+				switch {
+				case err != nil && p.KeepGoing && ctx.Err() == nil:
+					logutil.Errorf(logutil.Get(), "Failed: %s: %v\n", entry.Name, err)
+
+					mu.Lock()
+					failed = append(failed, fmt.Errorf("%s: %w", entry.Name, err))
+					mu.Unlock()
+				case err != nil:
+					cancel(err)
+				default:
+					downloaded.Add(1)
+				}
+			}
+		})
+	}
+
+	pending := slices.Concat(s.Missing, s.Outdated)
+
+	for _, entry := range pending {
+		select {
+		case entries <- entry:
+		case <-ctx.Done():
 		}
 
-		url := p.PatchURL + strings.ReplaceAll(entry.Name, "\\", "/")
+		if ctx.Err() != nil {
+			break
+		}
+	}
 
-		if err := fsutil.Ensure(path); err != nil {
-			return errutil.New("fsutil.Ensure", err)
+	close(entries)
+	wg.Wait()
+
+	if ctx.Err() == nil {
+		if len(failed) > 0 {
+			return errutil.WithFramef("%d files failed to download: %w", len(failed), errors.Join(failed...))
 		}
 
-		if fsutil.Validate(path, entry.Hash, md5.New()) {
+		return nil
+	}
+
+	if errors.Is(context.Cause(ctx), context.Canceled) {
+		logutil.Warnf(
+			logutil.Get(),
+			"Canceled: %d downloaded, %d up-to-date, %d remaining\n",
+			downloaded.Load(),
+			len(s.Current),
+			int64(len(pending))-downloaded.Load(),
+		)
+	}
+
+	return errors.Join(append(failed, context.Cause(ctx))...)
+}
+
+// checkSpace returns an error if the install directory does not have enough free
+// space for the files that are missing or outdated, unless Force is set.
+func (p *Patcher) checkSpace(s *Status) error {
+	if p.Force {
+		return nil
+	}
+
+	return fsutil.CheckSpace(filepath.Join(p.InstallDir, "."), s.Size())
+}
+
+// skip records the up-to-date files as skipped.
+func (p *Patcher) skip(entries []FileEntry) {
+	for _, entry := range entries {
+		if path, err := p.path(entry); err == nil {
 			logutil.Infof(logutil.Get(), "Skipping: %s (already up-to-date)\n", path)
-			continue
 		}
 
-		logutil.Infof(logutil.Get(), "Downloading: %s to %s\n", url, path)
-
-		if err := p.HTTPClient.Download(context.Background(), path, url); err != nil {
-			return errutil.New("p.HTTPClient.Download", err)
+		if p.progress != nil {
+			p.progress.Skip(entry.checksum().Size)
 		}
+
+		p.Report.add(entry, false, 0, nil)
+	}
+}
+
+// downloadFile downloads a single file entry.
+func (p *Patcher) downloadFile(ctx context.Context, entry FileEntry) error {
+	path, err := p.path(entry)
+	if err != nil {
+		return errutil.New("p.path", err)
+	}
+
+	urls := p.urls(entry)
+
+	if err := fsutil.Ensure(path); err != nil {
+		return errutil.New("fsutil.Ensure", err)
+	}
+
+	if err := p.backup(path); err != nil {
+		return errutil.New("p.backup", err)
 	}
 
+	logutil.Infof(logutil.Get(), "Downloading: %s to %s\n", urls[0], path)
+
+	if err := dlutil.DownloadMirrors(ctx, p.Source, path, urls, entry.checksum()); err != nil {
+		return errutil.New("dlutil.DownloadMirrors", err)
+	}
+
+	p.hashes.Update(path, entry.Hash)
+
+	logutil.Infof(logutil.Get(), "Finished: %s\n", path)
+
 	return nil
 }
 
+// sortMirrors orders the patch URLs according to the mirror strategy. The checksum
+// URLs keep their given order, since the checksum file decides which files are
+// trusted and must come from the canonical URL unless it fails.
+func (p *Patcher) sortMirrors(ctx context.Context) {
+	p.PatchURLs = dlutil.SortMirrors(ctx, p.Source, p.PatchURLs, p.MirrorStrategy)
+}
+
+// urls returns the URL of the file entry on every patch mirror.
+func (p *Patcher) urls(entry FileEntry) []string {
+	name := strings.ReplaceAll(entry.Name, "\\", "/")
+
+	urls := make([]string, 0, len(p.PatchURLs))
+	for _, base := range p.PatchURLs {
+		urls = append(urls, base+name)
+	}
+
+	return urls
+}
+
+// path returns the absolute local path of the file entry in the install directory.
+func (p *Patcher) path(entry FileEntry) (string, error) {
+	name, err := pathutil.SafeRel(entry.Name)
+	if err != nil {
+		return "", errutil.New("pathutil.SafeRel", err)
+	}
+
+	root := p.InstallDir
+	if p.UsePatchDir {
+		root = filepath.Join(root, p.PatchDir)
+	}
+
+	path, err := fsutil.SafeJoin(root, name)
+	if err != nil {
+		return "", errutil.New("fsutil.SafeJoin", err)
+	}
+
+	return path, nil
+}
+
+// readFiles reads the checksum file at path, rejecting it if any file name is unsafe.
+func readFiles(path string) (*Files, error) {
+	files, err := xmlutil.ReadAndUnmarshal[Files](path)
+	if err != nil {
+		return nil, errutil.New("xmlutil.ReadAndUnmarshal", err)
+	}
+
+	var errs []error
+
+	for _, entry := range files.Entries {
+		if _, err := pathutil.SafeRel(entry.Name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errutil.Newf("pathutil.SafeRel", "rejecting %s: %w", path, errors.Join(errs...))
+	}
+
+	return files, nil
+}
+
+// checksum returns the expected checksum of the file entry.
+func (e *FileEntry) checksum() dlutil.Checksum {
+	size, err := strconv.ParseInt(e.Filesize, 10, 64)
+	if err != nil {
+		size = 0
+	}
+
+	return dlutil.Checksum{MD5: e.Hash, Size: size}
+}
+
+// download returns the entries marked for download.
+func (f *Files) download() []FileEntry {
+	var entries []FileEntry
+
+	for _, entry := range f.Entries {
+		if strings.ToLower(entry.Download) == "true" {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
+
+// size returns the combined size of the files to download.
+func (f *Files) size() int64 {
+	var n int64
+
+	for _, entry := range f.Entries {
+		if strings.ToLower(entry.Download) == "true" {
+			n += entry.checksum().Size
+		}
+	}
+
+	return n
+}
+
+// jobs returns the number of download workers, defaulting to 1.
+func (p *Patcher) jobs() int {
+	if p.Jobs < 1 {
+		return 1
+	}
+
+	return p.Jobs
+}
+
+// restore restores the file at path to the previous data, removing it if there was none.
+func restore(path string, prev []byte) {
+	if prev == nil {
+		_ = os.Remove(path)
+		return
+	}
+
+	_ = fsutil.Write(path, prev)
+}
+
 // patchDir creates a top level patch folder name using CRC32 of all file hashes.
-func patchDir(files *Files) (string, error) {
+func patchDir(root string, files *Files) (string, error) {
+	path := patchDirName(files)
+	return path, os.MkdirAll(filepath.Join(root, path), 0o755)
+}
+
+// patchDirName returns the top level patch folder name using CRC32 of all file hashes.
+func patchDirName(files *Files) string {
 	var hash string
 
 	var sb strings.Builder
@@ -129,7 +491,6 @@ func patchDir(files *Files) (string, error) {
 
 	hash += sb.String()
 	crc := crc32.ChecksumIEEE([]byte(hash))
-	path := fmt.Sprintf("London2038Patcher/%08X", crc)
 
-	return path, os.MkdirAll(path, 0o755)
+	return fmt.Sprintf("London2038Patcher/%08X", crc)
 }
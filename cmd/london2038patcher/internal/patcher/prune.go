@@ -0,0 +1,141 @@
+package patcher
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ricochhet/london2038patcher/pkg/errutil"
+	"github.com/ricochhet/london2038patcher/pkg/logutil"
+	"github.com/ricochhet/london2038patcher/pkg/pathutil"
+)
+
+// Prune returns the files in the install directory that are not listed in the
+// saved checksum file, ignoring files matching the protect patterns. The files
+// are only removed if remove is true.
+func (p *Patcher) Prune(ctx context.Context, protect []string, remove bool) ([]string, error) {
+	files, err := readFiles(p.ChecksumFile)
+	if err != nil {
+		return nil, errutil.New("readFiles", err)
+	}
+
+	root := filepath.Join(p.InstallDir, ".")
+	if p.UsePatchDir {
+		root = filepath.Join(root, patchDirName(files))
+	}
+
+	tracked := make(map[string]struct{}, len(files.Entries))
+	for _, entry := range files.Entries {
+		tracked[pruneKey(entry.Name)] = struct{}{}
+	}
+
+	protect = append(protect, p.protected(root)...)
+
+	untracked, err := walkUntracked(ctx, root, tracked, protect)
+	if err != nil {
+		return nil, errutil.New("walkUntracked", err)
+	}
+
+	if !remove {
+		return untracked, nil
+	}
+
+	for _, rel := range untracked {
+		if ctx.Err() != nil {
+			return untracked, errutil.New("ctx.Err", context.Cause(ctx))
+		}
+
+		logutil.Infof(logutil.Get(), "Removing: %s\n", rel)
+
+		if err := os.Remove(filepath.Join(root, rel)); err != nil {
+			return untracked, errutil.New("os.Remove", err)
+		}
+	}
+
+	return untracked, nil
+}
+
+// protected returns the patterns for files the patcher itself owns in root.
+func (p *Patcher) protected(root string) []string {
+	patterns := []string{"London2038Patcher"}
+
+	for _, path := range []string{
+		p.ChecksumFile,
+		signaturePath(p.ChecksumFile),
+		p.statePath(),
+		p.hashesPath(),
+		p.installedPath(),
+	} {
+		if rel, err := filepath.Rel(root, path); err == nil {
+			patterns = append(patterns, filepath.ToSlash(rel))
+		}
+	}
+
+	if exe, err := os.Executable(); err == nil {
+		if rel, err := filepath.Rel(root, exe); err == nil {
+			patterns = append(patterns, filepath.ToSlash(rel))
+		}
+	}
+
+	return patterns
+}
+
+// walkUntracked walks root and returns the relative paths of files not in tracked,
+// stopping if ctx is canceled.
+func walkUntracked(
+	ctx context.Context,
+	root string,
+	tracked map[string]struct{},
+	protect []string,
+) ([]string, error) {
+	var untracked []string
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return errutil.WithFrame(err)
+		}
+
+		if ctx.Err() != nil {
+			return errutil.New("ctx.Err", context.Cause(ctx))
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return errutil.New("filepath.Rel", err)
+		}
+
+		if rel == "." {
+			return nil
+		}
+
+		if pathutil.Match(protect, filepath.ToSlash(rel)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		if _, ok := tracked[pruneKey(rel)]; !ok {
+			untracked = append(untracked, rel)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, errutil.WithFrame(err)
+	}
+
+	return untracked, nil
+}
+
+// pruneKey normalizes a file name for comparison, ignoring separators and case.
+func pruneKey(name string) string {
+	return strings.ToLower(strings.ReplaceAll(filepath.ToSlash(name), "\\", "/"))
+}
@@ -0,0 +1,58 @@
+package patcher
+
+import (
+	"time"
+
+	"github.com/sasha-s/go-deadlock"
+)
+
+type Report struct {
+	mu deadlock.Mutex
+
+	Downloaded []FileReport `json:"downloaded"`
+	Skipped    []FileReport `json:"skipped"` // Already up-to-date.
+	Failed     []FileReport `json:"failed"`
+}
+
+type FileReport struct {
+	Name    string  `json:"name"`
+	Bytes   int64   `json:"bytes"`
+	Seconds float64 `json:"seconds"`
+	Error   string  `json:"error,omitempty"`
+}
+
+// NewReport returns a Report struct with empty lists.
+func NewReport() *Report {
+	return &Report{
+		Downloaded: []FileReport{},
+		Skipped:    []FileReport{},
+		Failed:     []FileReport{},
+	}
+}
+
+// add records the result of downloading the file entry. Calling add on a nil
+// Report does nothing.
+func (r *Report) add(entry FileEntry, downloaded bool, elapsed time.Duration, err error) {
+	if r == nil {
+		return
+	}
+
+	f := FileReport{
+		Name:    entry.Name,
+		Bytes:   entry.checksum().Size,
+		Seconds: elapsed.Seconds(),
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch {
+	case err != nil:
+		f.Error = err.Error()
+		r.Failed = append(r.Failed, f)
+	case downloaded:
+		r.Downloaded = append(r.Downloaded, f)
+	default:
+		r.Skipped = append(r.Skipped, f)
+	}
+}
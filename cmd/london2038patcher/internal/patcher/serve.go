@@ -0,0 +1,150 @@
+package patcher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ricochhet/london2038patcher/pkg/errutil"
+	"github.com/ricochhet/london2038patcher/pkg/fsutil"
+	"github.com/ricochhet/london2038patcher/pkg/httputil"
+	"github.com/ricochhet/london2038patcher/pkg/logutil"
+	"github.com/ricochhet/london2038patcher/pkg/pathutil"
+)
+
+type Server struct {
+	checksum string
+	files    map[string]serverFile
+}
+
+type serverFile struct {
+	path string
+	hash string
+}
+
+// NewServer returns a Server for the checksum file and the patch files it lists
+// in dir, using the same URL layout as the patcher.
+func NewServer(dir, checksum string) (*Server, error) {
+	checksum = filepath.Base(checksum)
+
+	files, err := readFiles(filepath.Join(dir, checksum))
+	if err != nil {
+		return nil, errutil.New("readFiles", err)
+	}
+
+	s := &Server{
+		checksum: checksum,
+		files: map[string]serverFile{
+			checksum: {path: filepath.Join(dir, checksum)},
+		},
+	}
+
+	if sig := signaturePath(checksum); fsutil.Exists(filepath.Join(dir, sig)) {
+		s.files[sig] = serverFile{path: filepath.Join(dir, sig)}
+	}
+
+	for _, entry := range files.Entries {
+		name := strings.ReplaceAll(entry.Name, "\\", "/")
+
+		rel, err := pathutil.SafeRel(entry.Name)
+		if err != nil {
+			return nil, errutil.New("pathutil.SafeRel", err)
+		}
+
+		path, err := fsutil.SafeJoin(dir, rel)
+		if err != nil {
+			return nil, errutil.New("fsutil.SafeJoin", err)
+		}
+
+		if !fsutil.Exists(path) {
+			logutil.Warnf(logutil.Get(), "Missing file, not serving: %s\n", entry.Name)
+			continue
+		}
+
+		s.files[name] = serverFile{path: path, hash: strings.ToUpper(entry.Hash)}
+	}
+
+	return s, nil
+}
+
+// ListenAndServe serves the files on the specified address until ctx is canceled,
+// then shuts the server down gracefully.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	logutil.Infof(logutil.Get(), "Serving %d files from %s on %s\n", len(s.files), s.checksum, addr)
+
+	done := make(chan error, 1)
+
+	go func() {
+		<-ctx.Done()
+
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		logutil.Infof(logutil.Get(), "Shutting down server\n")
+
+		done <- srv.Shutdown(shutdown)
+	}()
+
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return errutil.New("srv.ListenAndServe", err)
+	}
+
+	if err := <-done; err != nil {
+		return errutil.New("srv.Shutdown", err)
+	}
+
+	return nil
+}
+
+// ServeHTTP serves the checksum file or a patch file, supporting range requests.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		httputil.Error(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/")
+
+	file, ok := s.files[name]
+	if !ok {
+		httputil.Error(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	f, err := os.Open(file.path)
+	if err != nil {
+		httputil.Error(w, http.StatusInternalServerError, "failed to open file")
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		httputil.Error(w, http.StatusInternalServerError, "failed to stat file")
+		return
+	}
+
+	if name == s.checksum || name == signaturePath(s.checksum) {
+		httputil.ContentType(w, httputil.ContentTypeXML)
+		httputil.NoCache(w)
+	} else {
+		httputil.ContentType(w, httputil.ContentTypeBinary)
+		httputil.ETag(w, file.hash)
+	}
+
+	httputil.NoSniff(w)
+
+	logutil.Debugf(logutil.Get(), "Serving: %s to %s\n", name, r.RemoteAddr)
+
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
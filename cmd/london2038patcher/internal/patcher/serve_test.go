@@ -0,0 +1,171 @@
+package patcher
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ricochhet/london2038patcher/pkg/dlutil"
+	"github.com/ricochhet/london2038patcher/pkg/logutil"
+)
+
+func TestMain(m *testing.M) {
+	logutil.Set(logutil.NewLogger("test", 0))
+	os.Exit(m.Run())
+}
+
+type recorder struct {
+	http.ResponseWriter
+
+	status int
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// newTestServer writes the files into a temp dir with a checksum file listing them
+// and serves it, recording the status of every response by path.
+func newTestServer(t *testing.T, files map[string][]byte) (*httptest.Server, string, *sync.Map) {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := GenerateManifest(
+		context.Background(),
+		dir,
+		filepath.Join(dir, "checksums.xml"),
+		&ManifestOptions{},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewServer(dir, "checksums.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var statuses sync.Map
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		s.ServeHTTP(rec, r)
+		statuses.Store(r.URL.Path, rec.status)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, dir, &statuses
+}
+
+// newTestPatcher returns a Patcher installing from srv into a temp dir.
+func newTestPatcher(t *testing.T, srv *httptest.Server) *Patcher {
+	t.Helper()
+
+	inst := t.TempDir()
+
+	return &Patcher{
+		Source:       dlutil.NewSources(dlutil.NewHTTPClient(0)),
+		ChecksumURLs: []string{srv.URL + "/checksums.xml"},
+		PatchURLs:    []string{srv.URL + "/"},
+		ChecksumFile: filepath.Join(inst, "checksums.xml"),
+		InstallDir:   inst,
+		Jobs:         2,
+	}
+}
+
+func TestServerDownload(t *testing.T) {
+	files := map[string][]byte{
+		"a.txt": []byte("hello"),
+		"b.bin": bytes.Repeat([]byte("0123456789"), 1000),
+	}
+
+	srv, _, _ := newTestServer(t, files)
+	p := newTestPatcher(t, srv)
+
+	if err := p.Download(context.Background()); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(p.InstallDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: got %d bytes, want %d", name, len(got), len(want))
+		}
+	}
+}
+
+func TestServerResume(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+
+	srv, _, statuses := newTestServer(t, map[string][]byte{"b.bin": data})
+	p := newTestPatcher(t, srv)
+
+	sum := md5.Sum(data)
+	etag := `"` + strings.ToUpper(hex.EncodeToString(sum[:])) + `"`
+	tmp := filepath.Join(p.InstallDir, "b.bin.tmp")
+
+	if err := os.WriteFile(tmp, data[:4000], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(tmp+".etag", []byte(etag), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Download(context.Background()); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+
+	if status, _ := statuses.Load("/b.bin"); status != http.StatusPartialContent {
+		t.Errorf("status = %v, want %d", status, http.StatusPartialContent)
+	}
+
+	got, err := os.ReadFile(filepath.Join(p.InstallDir, "b.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, data) {
+		t.Errorf("got %d bytes, want %d", len(got), len(data))
+	}
+}
+
+func TestServerNotListed(t *testing.T) {
+	srv, dir, _ := newTestServer(t, map[string][]byte{"a.txt": []byte("hello")})
+
+	if err := os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"secret.txt", "missing.txt"} {
+		resp, err := http.Get(srv.URL + "/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want %d", name, resp.StatusCode, http.StatusNotFound)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package patcher
+
+import (
+	"context"
+	"os"
+
+	"github.com/ricochhet/london2038patcher/pkg/cryptoutil"
+	"github.com/ricochhet/london2038patcher/pkg/dlutil"
+	"github.com/ricochhet/london2038patcher/pkg/errutil"
+	"github.com/ricochhet/london2038patcher/pkg/fsutil"
+)
+
+// GenerateKey writes a new ed25519 private key to path and the public key to
+// path + ".pub", returning the public key.
+func GenerateKey(path string) (string, error) {
+	if fsutil.Exists(path) {
+		return "", errutil.WithFramef("key already exists: %s", path)
+	}
+
+	pub, priv, err := cryptoutil.GenerateEd25519()
+	if err != nil {
+		return "", errutil.New("cryptoutil.GenerateEd25519", err)
+	}
+
+	if err := fsutil.Ensure(path); err != nil {
+		return "", errutil.New("fsutil.Ensure", err)
+	}
+
+	if err := os.WriteFile(path, []byte(priv+"\n"), 0o600); err != nil {
+		return "", errutil.New("os.WriteFile", err)
+	}
+
+	if err := fsutil.Write(path+".pub", []byte(pub+"\n")); err != nil {
+		return "", errutil.New("fsutil.Write", err)
+	}
+
+	return pub, nil
+}
+
+// SignManifest signs the checksum file at path with the private key file and
+// writes the signature to path + ".sig".
+func SignManifest(privateKey, path string) error {
+	key, err := fsutil.Read(privateKey)
+	if err != nil {
+		return errutil.New("fsutil.Read", err)
+	}
+
+	data, err := fsutil.Read(path)
+	if err != nil {
+		return errutil.New("fsutil.Read", err)
+	}
+
+	sig, err := cryptoutil.SignEd25519(string(key), data)
+	if err != nil {
+		return errutil.New("cryptoutil.SignEd25519", err)
+	}
+
+	return fsutil.Write(signaturePath(path), []byte(sig+"\n"))
+}
+
+// downloadSignature downloads the signature of the checksum file and verifies it.
+func (p *Patcher) downloadSignature(ctx context.Context) error {
+	if p.PublicKey == nil {
+		return nil
+	}
+
+	urls := make([]string, 0, len(p.ChecksumURLs))
+	for _, url := range p.ChecksumURLs {
+		urls = append(urls, signaturePath(url))
+	}
+
+	if err := dlutil.DownloadMirrors(
+		ctx,
+		p.Source,
+		signaturePath(p.ChecksumFile),
+		urls,
+		dlutil.Checksum{},
+	); err != nil {
+		return errutil.New("dlutil.DownloadMirrors", err)
+	}
+
+	return p.verifySignature()
+}
+
+// verifySignature verifies the checksum file against its signature file if a
+// public key is set.
+func (p *Patcher) verifySignature() error {
+	if p.PublicKey == nil {
+		return nil
+	}
+
+	data, err := fsutil.Read(p.ChecksumFile)
+	if err != nil {
+		return errutil.New("fsutil.Read", err)
+	}
+
+	sig, err := fsutil.Read(signaturePath(p.ChecksumFile))
+	if err != nil {
+		return errutil.New("fsutil.Read", err)
+	}
+
+	if err := cryptoutil.VerifyEd25519(p.PublicKey, data, string(sig)); err != nil {
+		return errutil.Newf("cryptoutil.VerifyEd25519", "signature verification of %s failed: %w", p.ChecksumFile, err)
+	}
+
+	return nil
+}
+
+// signaturePath returns the path or URL of the signature of the checksum file.
+func signaturePath(path string) string {
+	return path + ".sig"
+}
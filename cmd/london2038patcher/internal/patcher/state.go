@@ -0,0 +1,87 @@
+package patcher
+
+import (
+	"github.com/ricochhet/london2038patcher/pkg/errutil"
+	"github.com/ricochhet/london2038patcher/pkg/fsutil"
+	"github.com/ricochhet/london2038patcher/pkg/jsonutil"
+	"github.com/ricochhet/london2038patcher/pkg/logutil"
+)
+
+type checksumState struct {
+	ETag         string `json:"etag"`
+	LastModified string `json:"lastModified"`
+	Current      bool   `json:"current"`     // The install matched the checksum file after the last download.
+	UsePatchDir  bool   `json:"usePatchDir"` // The last download used the patch directory.
+}
+
+// readState reads the state of the checksum file, returning an empty state if there is none.
+func (p *Patcher) readState() *checksumState {
+	path := p.statePath()
+	if !fsutil.Exists(path) {
+		return &checksumState{}
+	}
+
+	s, err := jsonutil.ReadAndUnmarshal[checksumState](path)
+	if err != nil {
+		return &checksumState{}
+	}
+
+	return s
+}
+
+// writeState writes the state of the checksum file.
+func (p *Patcher) writeState(s *checksumState) error {
+	if _, err := jsonutil.MarshalAndWrite(p.statePath(), s); err != nil {
+		return errutil.New("jsonutil.MarshalAndWrite", err)
+	}
+
+	return nil
+}
+
+// markOutdated records that the install no longer matches the checksum file, so
+// the next download checks every file even if the checksum file did not change.
+func (p *Patcher) markOutdated() error {
+	s := p.readState()
+	if !s.Current {
+		return nil
+	}
+
+	s.Current = false
+
+	return p.writeState(s)
+}
+
+// markCurrent records that the install matches the checksum file.
+func (p *Patcher) markCurrent() error {
+	s := p.readState()
+	s.Current = true
+	s.UsePatchDir = p.UsePatchDir
+
+	return p.writeState(s)
+}
+
+// loadHashes loads the hash cache of the checksum file unless it is already loaded.
+func (p *Patcher) loadHashes() {
+	if p.hashes == nil {
+		p.hashes = fsutil.LoadHashCache(p.hashesPath())
+		p.hashes.Rehash = p.Rehash
+	}
+}
+
+// saveHashes writes the hash cache, logging any error since the cache is only an
+// optimization.
+func (p *Patcher) saveHashes() {
+	if err := p.hashes.Save(); err != nil {
+		logutil.Warnf(logutil.Get(), "Error saving hash cache: %v\n", err)
+	}
+}
+
+// hashesPath returns the path of the hash cache next to the checksum file.
+func (p *Patcher) hashesPath() string {
+	return p.ChecksumFile + ".hashes.json"
+}
+
+// statePath returns the path of the state file next to the checksum file.
+func (p *Patcher) statePath() string {
+	return p.ChecksumFile + ".state.json"
+}
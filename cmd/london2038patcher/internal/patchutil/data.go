@@ -2,6 +2,8 @@ package patchutil
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"hash/crc32"
 	"io"
@@ -10,11 +12,16 @@ import (
 	"slices"
 
 	"github.com/ricochhet/london2038patcher/pkg/errutil"
+	"github.com/ricochhet/london2038patcher/pkg/fsutil"
 	"github.com/ricochhet/london2038patcher/pkg/logutil"
+	"github.com/ricochhet/london2038patcher/pkg/pathutil"
 )
 
-// Unpack unpacks the specified path with the provided index.
+// Unpack unpacks the specified path with the provided index, stopping between
+// entries if the context is done. With opts.KeepGoing, entries that fail are
+// skipped and returned together as one error after all other entries are unpacked.
 func (idx *Index) Unpack(
+	ctx context.Context,
 	path, output string,
 	locales *LocaleFilter,
 	archs []string,
@@ -26,65 +33,173 @@ func (idx *Index) Unpack(
 	}
 	defer f.Close()
 
+	targets, err := idx.targets(output, locales, archs, opts.StrictPaths)
+	if err != nil {
+		return errutil.New("idx.targets", err)
+	}
+
+	if !opts.Force {
+		if err := fsutil.CheckSpace(output, idx.size(targets)); err != nil {
+			return errutil.New("fsutil.CheckSpace", err)
+		}
+	}
+
 	if err := os.MkdirAll(output, 0o755); err != nil {
 		return errutil.New("os.MkdirAll", err)
 	}
 
-	for _, entry := range idx.Files {
-		if entry.FileSize <= 0 ||
-			!locales.Allowed(entry.Localization) ||
-			entry.skipArch(archs) {
-			continue
-		}
+	var failed []error
 
-		target := filepath.Join(output, filepath.FromSlash(entry.FileName))
-		if entry.Localization != 0 {
-			target += fmt.Sprintf(".%d", entry.Localization)
+	for i, entry := range idx.Files {
+		if ctx.Err() != nil {
+			return errutil.New("ctx.Err", errors.Join(append(failed, context.Cause(ctx))...))
 		}
 
-		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
-			return errutil.New("os.MkdirAll", err)
+		target := targets[i]
+		if target == "" {
+			continue
 		}
 
-		logutil.Infof(logutil.Get(), "Extracting: %s (%d bytes)\n", target, entry.FileSize)
+		if err := entry.extract(f, target, opts); err != nil {
+			if !opts.KeepGoing {
+				return errutil.New("entry.extract", err)
+			}
 
-		if _, err := f.Seek(entry.DatOffset, io.SeekStart); err != nil {
-			return errutil.New("f.Seek", err)
+			logutil.Errorf(logutil.Get(), "Failed: %s: %v\n", target, err)
+
+			failed = append(failed, fmt.Errorf("%s: %w", target, err))
 		}
+	}
+
+	if len(failed) > 0 {
+		return errutil.WithFramef("%d entries failed to unpack: %w", len(failed), errors.Join(failed...))
+	}
+
+	return nil
+}
 
-		buf := make([]byte, entry.FileSize)
-		if _, err := io.ReadFull(f, buf); err != nil {
-			return errutil.New("io.ReadFull", err)
+// extract writes the data of the entry in f to target.
+func (e *Entry) extract(f *os.File, target string, opts *IdxOptions) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return errutil.New("os.MkdirAll", err)
+	}
+
+	logutil.Infof(logutil.Get(), "Extracting: %s (%d bytes)\n", target, e.FileSize)
+
+	if _, err := f.Seek(e.DatOffset, io.SeekStart); err != nil {
+		return errutil.New("f.Seek", err)
+	}
+
+	buf := make([]byte, e.FileSize)
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return errutil.New("io.ReadFull", err)
+	}
+
+	outFile, err := os.Create(target)
+	if err != nil {
+		return errutil.New("os.Create", err)
+	}
+
+	bw := bufio.NewWriterSize(outFile, 4*1024*1024)
+	if _, err := bw.Write(buf); err != nil {
+		outFile.Close()
+		return errutil.New("bw.Write", err)
+	}
+
+	if err := bw.Flush(); err != nil {
+		outFile.Close()
+		return errutil.New("bw.Flush", err)
+	}
+
+	mismatch := opts.Debug && !e.validateCRC32(buf)
+	opts.Report.add(e, target, e.FileSize, mismatch)
+
+	return outFile.Close()
+}
+
+// targets returns the output path of every entry to unpack, or an empty string for
+// entries that are skipped. Entries with unsafe file names are an error if strict
+// is set, otherwise they are skipped and reported.
+func (idx *Index) targets(
+	output string,
+	locales *LocaleFilter,
+	archs []string,
+	strict bool,
+) ([]string, error) {
+	targets := make([]string, len(idx.Files))
+
+	var errs []error
+
+	for i, entry := range idx.Files {
+		if entry.FileSize <= 0 ||
+			!locales.Allowed(entry.Localization) ||
+			entry.skipArch(archs) {
+			continue
 		}
 
-		outFile, err := os.Create(target)
+		target, err := entry.target(output)
 		if err != nil {
-			return errutil.New("os.Create", err)
+			errs = append(errs, err)
+			continue
 		}
 
-		bw := bufio.NewWriterSize(outFile, 4*1024*1024)
-		if _, err := bw.Write(buf); err != nil {
-			outFile.Close()
-			return errutil.New("bw.Write", err)
-		}
+		targets[i] = target
+	}
 
-		if err := bw.Flush(); err != nil {
-			outFile.Close()
-			return errutil.New("bw.Flush", err)
-		}
+	if len(errs) == 0 {
+		return targets, nil
+	}
+
+	if strict {
+		return nil, errutil.WithFrame(errors.Join(errs...))
+	}
+
+	for _, err := range errs {
+		logutil.Warnf(logutil.Get(), "Skipping: %v\n", err)
+	}
+
+	logutil.Warnf(logutil.Get(), "Skipped %d entries with unsafe file names\n", len(errs))
+
+	return targets, nil
+}
+
+// size returns the combined size of the entries with a target.
+func (idx *Index) size(targets []string) int64 {
+	var n int64
 
-		if opts.Debug {
-			_ = entry.validateCRC32(buf)
+	for i, entry := range idx.Files {
+		if targets[i] != "" {
+			n += entry.FileSize
 		}
+	}
 
-		outFile.Close()
+	return n
+}
+
+// target returns the output path of the entry, rejecting file names that are
+// absolute, drive qualified or escape output.
+func (e *Entry) target(output string) (string, error) {
+	name, err := pathutil.SafeRel(e.FileName)
+	if err != nil {
+		return "", errutil.New("pathutil.SafeRel", err)
 	}
 
-	return nil
+	target, err := fsutil.SafeJoin(output, name)
+	if err != nil {
+		return "", errutil.New("fsutil.SafeJoin", err)
+	}
+
+	if e.Localization != 0 {
+		target += fmt.Sprintf(".%d", e.Localization)
+	}
+
+	return target, nil
 }
 
-// Pack packs the specified path with the provided index.
+// Pack packs the specified path with the provided index, stopping between
+// entries if the context is done.
 func (idx *Index) Pack(
+	ctx context.Context,
 	path, output string,
 	locales *LocaleFilter,
 	archs []string,
@@ -100,19 +215,26 @@ func (idx *Index) Pack(
 	defer bw.Flush()
 
 	for _, entry := range idx.Files {
+		if ctx.Err() != nil {
+			return errutil.New("ctx.Err", context.Cause(ctx))
+		}
+
 		if !locales.Allowed(entry.Localization) || entry.skipArch(archs) {
 			continue
 		}
 
-		source := filepath.Join(path, filepath.FromSlash(entry.FileName))
-		if entry.Localization != 0 {
-			source += fmt.Sprintf(".%d", entry.Localization)
+		source, err := entry.target(path)
+		if err != nil {
+			return errutil.New("entry.target", err)
 		}
 
 		buf, err := os.ReadFile(source)
+		actual := int64(len(buf))
+
 		switch {
 		case err != nil:
 			buf = make([]byte, entry.FileSize)
+			actual = -1
 
 			logutil.Infof(logutil.Get(), "Missing file, zeroing: %s\n", source)
 		case int64(len(buf)) < entry.FileSize:
@@ -131,9 +253,8 @@ func (idx *Index) Pack(
 			return errutil.New("bw.Write", err)
 		}
 
-		if opts.Debug {
-			_ = entry.validateCRC32(buf)
-		}
+		mismatch := opts.Debug && !entry.validateCRC32(buf)
+		opts.Report.add(&entry, source, actual, mismatch)
 
 		logutil.Infof(logutil.Get(), "Packing: %s (%d bytes)\n", source, len(buf))
 	}
@@ -143,6 +264,7 @@ func (idx *Index) Pack(
 
 // PackWithIndex generates both a .dat and .idx file from the input folder.
 func (lm *LocaleRegistry) PackWithIndex(
+	ctx context.Context,
 	path, index, patch string,
 	locales *LocaleFilter,
 	archs []string,
@@ -153,11 +275,12 @@ func (lm *LocaleRegistry) PackWithIndex(
 	idx.Header.PatchType = 1
 	idx.Header.EndToken = 1147496776
 
-	return lm.packWithIndex(path, index, patch, &idx, locales, archs, opts)
+	return lm.packWithIndex(ctx, path, index, patch, &idx, locales, archs, opts)
 }
 
 // PackWithIndex generates both a .dat and .idx file from the input folder.
 func (lm *LocaleRegistry) packWithIndex(
+	ctx context.Context,
 	path, index, patch string,
 	idx *Index,
 	locales *LocaleFilter,
@@ -180,6 +303,10 @@ func (lm *LocaleRegistry) packWithIndex(
 	defer bw.Flush()
 
 	for i := range idx.Files {
+		if ctx.Err() != nil {
+			return errutil.New("ctx.Err", context.Cause(ctx))
+		}
+
 		entry := &idx.Files[i]
 
 		if entry.skipArch(archs) {
@@ -192,8 +319,11 @@ func (lm *LocaleRegistry) packWithIndex(
 		}
 
 		buf, err := os.ReadFile(source)
+		actual := int64(len(buf))
+
 		if err != nil {
 			buf = make([]byte, entry.FileSize)
+			actual = -1
 		}
 
 		if _, err := bw.Write(buf); err != nil {
@@ -204,6 +334,8 @@ func (lm *LocaleRegistry) packWithIndex(
 			entry.Hash = crc32.ChecksumIEEE(buf)
 		}
 
+		opts.Report.add(entry, source, actual, false)
+
 		logutil.Infof(logutil.Get(), "Packing: %s (%d bytes)\n", source, len(buf))
 	}
 
@@ -10,4 +10,9 @@ type Options struct {
 type IdxOptions struct {
 	Debug bool
 	CRC32 bool // PackWithIndex
+
+	StrictPaths bool    // Unpack fails on unsafe file names instead of skipping them.
+	Force       bool    // Unpack skips the free disk space check.
+	KeepGoing   bool    // Unpack skips entries that fail and reports them at the end.
+	Report      *Report // Records every entry packed or unpacked if set.
 }
@@ -1,6 +1,10 @@
 package patchutil
 
 import (
+	"context"
+	"errors"
+	"fmt"
+
 	"github.com/ricochhet/london2038patcher/pkg/errutil"
 	"github.com/ricochhet/london2038patcher/pkg/fsutil"
 	"github.com/ricochhet/london2038patcher/pkg/jsonutil"
@@ -16,7 +20,7 @@ type Patch struct {
 }
 
 // Unpack unpacks the patch file with the given index.
-func (o *Options) Unpack(index, patch, output string) error {
+func (o *Options) Unpack(ctx context.Context, index, patch, output string) error {
 	if !fsutil.Exists(index) {
 		return errutil.Newf("fsutil.Exists(index)", "path does not exist: %s", index)
 	}
@@ -35,7 +39,7 @@ func (o *Options) Unpack(index, patch, output string) error {
 		return errutil.New("Decode", err)
 	}
 
-	if err := idx.Unpack(patch, output, o.Filter, o.Archs, o.IdxOptions); err != nil {
+	if err := idx.Unpack(ctx, patch, output, o.Filter, o.Archs, o.IdxOptions); err != nil {
 		return errutil.New("idx.Unpack", err)
 	}
 
@@ -43,7 +47,7 @@ func (o *Options) Unpack(index, patch, output string) error {
 }
 
 // Pack packs the path with the given index.
-func (o *Options) Pack(index, path, output string) error {
+func (o *Options) Pack(ctx context.Context, index, path, output string) error {
 	if !fsutil.Exists(index) {
 		return errutil.WithFramef("path does not exist: %s", index)
 	}
@@ -58,7 +62,7 @@ func (o *Options) Pack(index, path, output string) error {
 		return errutil.New("Decode", err)
 	}
 
-	if err := idx.Pack(path, output, o.Filter, o.Archs, o.IdxOptions); err != nil {
+	if err := idx.Pack(ctx, path, output, o.Filter, o.Archs, o.IdxOptions); err != nil {
 		return errutil.New("idx.Pack", err)
 	}
 
@@ -66,8 +70,9 @@ func (o *Options) Pack(index, path, output string) error {
 }
 
 // Pack packs the path with the given index.
-func (o *Options) PackWithIndex(path, index, patch string) error {
+func (o *Options) PackWithIndex(ctx context.Context, path, index, patch string) error {
 	if err := o.Registry.PackWithIndex(
+		ctx,
 		path,
 		index,
 		patch,
@@ -82,7 +87,7 @@ func (o *Options) PackWithIndex(path, index, patch string) error {
 }
 
 // UnpackFromFile unpacks the patches from the specified file to the given output.
-func (o *Options) UnpackFromFile(path, output string) error {
+func (o *Options) UnpackFromFile(ctx context.Context, path, output string) error {
 	if !fsutil.Exists(path) {
 		return errutil.WithFramef("path does not exist: %s", path)
 	}
@@ -92,16 +97,23 @@ func (o *Options) UnpackFromFile(path, output string) error {
 		return errutil.New("jsonutil.ReadAndUnmarshal", err)
 	}
 
-	return o.unpackFromFile(output, p)
+	return o.unpackFromFile(ctx, output, p)
 }
 
-// unpackFromFile unpacks the patch files specified to the given output.
-func (o *Options) unpackFromFile(output string, patches *Patches) error {
+// unpackFromFile unpacks the patch files specified to the given output. With
+// KeepGoing, the remaining patches are still unpacked if one fails.
+func (o *Options) unpackFromFile(ctx context.Context, output string, patches *Patches) error {
+	var failed []error
+
 	for _, patch := range patches.Patches {
-		if err := o.Unpack(patch.Idx, patch.Dat, output); err != nil {
-			return errutil.WithFrame(err)
+		if err := o.Unpack(ctx, patch.Idx, patch.Dat, output); err != nil {
+			if !o.IdxOptions.KeepGoing || ctx.Err() != nil {
+				return errutil.WithFrame(errors.Join(append(failed, err)...))
+			}
+
+			failed = append(failed, fmt.Errorf("%s: %w", patch.Dat, err))
 		}
 	}
 
-	return nil
+	return errutil.WithFrame(errors.Join(failed...))
 }
@@ -0,0 +1,59 @@
+package patchutil
+
+type Report struct {
+	Processed      []EntryReport `json:"processed"`
+	ZeroFilled     []EntryReport `json:"zeroFilled"`     // Missing files packed as zeros.
+	Truncated      []EntryReport `json:"truncated"`      // Files larger than the entry, cut to its size.
+	Padded         []EntryReport `json:"padded"`         // Files smaller than the entry, padded with zeros.
+	HashMismatches []EntryReport `json:"hashMismatches"` // Entries whose CRC32 did not match the index.
+}
+
+type EntryReport struct {
+	Name         string `json:"name"`
+	Path         string `json:"path"`
+	Localization int16  `json:"localization"`
+	Bytes        int64  `json:"bytes"`       // Size in the index.
+	ActualBytes  int64  `json:"actualBytes"` // Size of the file, -1 if missing.
+}
+
+// NewReport returns a Report struct with empty lists.
+func NewReport() *Report {
+	return &Report{
+		Processed:      []EntryReport{},
+		ZeroFilled:     []EntryReport{},
+		Truncated:      []EntryReport{},
+		Padded:         []EntryReport{},
+		HashMismatches: []EntryReport{},
+	}
+}
+
+// add records the entry written from or to path, where actual is the size of the
+// file or -1 if it is missing. Calling add on a nil Report does nothing.
+func (r *Report) add(e *Entry, path string, actual int64, mismatch bool) {
+	if r == nil {
+		return
+	}
+
+	er := EntryReport{
+		Name:         e.FileName,
+		Path:         path,
+		Localization: e.Localization,
+		Bytes:        e.FileSize,
+		ActualBytes:  actual,
+	}
+
+	r.Processed = append(r.Processed, er)
+
+	switch {
+	case actual < 0:
+		r.ZeroFilled = append(r.ZeroFilled, er)
+	case actual < e.FileSize:
+		r.Padded = append(r.Padded, er)
+	case actual > e.FileSize:
+		r.Truncated = append(r.Truncated, er)
+	}
+
+	if mismatch {
+		r.HashMismatches = append(r.HashMismatches, er)
+	}
+}
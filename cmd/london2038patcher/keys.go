@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"embed"
+	"strings"
+
+	"github.com/ricochhet/london2038patcher/pkg/cryptoutil"
+	"github.com/ricochhet/london2038patcher/pkg/embedutil"
+	"github.com/ricochhet/london2038patcher/pkg/errutil"
+)
+
+//go:embed keys
+var keysFS embed.FS
+
+var keys = &embedutil.EmbeddedFileSystem{Initial: "keys", FS: keysFS}
+
+// publicKey returns the public key from the flags, either base64 encoded or an
+// embedded key file prefixed with "asset:".
+func publicKey() (ed25519.PublicKey, error) {
+	if flags.PublicKey == "" {
+		return nil, nil
+	}
+
+	b, err := embedutil.MaybeBase64(keys, flags.PublicKey)
+	if err != nil {
+		return nil, errutil.New("embedutil.MaybeBase64", err)
+	}
+
+	if len(b) != ed25519.PublicKeySize {
+		b, err = cryptoutil.DecodeB64(strings.TrimSpace(string(b)))
+		if err != nil {
+			return nil, errutil.New("cryptoutil.DecodeB64", err)
+		}
+	}
+
+	if len(b) != ed25519.PublicKeySize {
+		return nil, errutil.WithFramef("invalid public key size %d", len(b))
+	}
+
+	return ed25519.PublicKey(b), nil
+}
@@ -1,15 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/ricochhet/london2038patcher/cmd/london2038patcher/internal/patcher"
 	"github.com/ricochhet/london2038patcher/cmd/london2038patcher/internal/patchutil"
 	"github.com/ricochhet/london2038patcher/pkg/cmdutil"
 	"github.com/ricochhet/london2038patcher/pkg/dlutil"
+	"github.com/ricochhet/london2038patcher/pkg/errutil"
+	"github.com/ricochhet/london2038patcher/pkg/fsutil"
 	"github.com/ricochhet/london2038patcher/pkg/logutil"
 	"github.com/ricochhet/london2038patcher/pkg/strutil"
 	"github.com/ricochhet/london2038patcher/pkg/winutil"
@@ -35,34 +42,124 @@ func main() {
 	logutil.SetDebug(flags.Debug)
 	_ = cmdutil.QuickEdit(flags.QuickEdit)
 
-	cmd, err := commands()
+	report = newRunReport()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := run(ctx)
+
+	stop()
+
+	if err := report.write(err); err != nil {
+		logutil.Errorf(logutil.Get(), "Error writing report: %v\n", err)
+	}
+
 	if err != nil {
-		logutil.Errorf(logutil.Get(), "Error running command: %v\n", err)
+		exit(err)
 	}
+}
 
-	if cmd {
-		return
+// run sets up the patcher and runs the specified command, or downloads the files
+// if no command is specified.
+func run(ctx context.Context) error {
+	client, err := dlutil.NewHTTPClientFromOptions(&dlutil.ClientOptions{
+		Timeout:   time.Duration(flags.Timeout),
+		Proxy:     flags.Proxy,
+		CABundle:  flags.CABundle,
+		UserAgent: flags.UserAgent,
+		Headers:   flags.Headers,
+	})
+	if err != nil {
+		return err
+	}
+
+	client.Retry = dlutil.DefaultRetryPolicy(flags.Retries+1, flags.RetryDelay)
+	client.Retry.MaxDelay = flags.RetryMaxDelay
+
+	if err := rateLimit(ctx, client); err != nil {
+		return err
+	}
+
+	key, err := publicKey()
+	if err != nil {
+		return err
 	}
 
 	p := patcher.NewContext()
 	p.Set(&patcher.Patcher{
-		HTTPClient:    *dlutil.NewHTTPClient(time.Duration(flags.Timeout)),
-		ChecksumURL:   flags.ChecksumURL,
-		PatchURL:      flags.PatchURL,
-		ChecksumFile:  flags.ChecksumFile,
-		HellgateCUKey: "",
-		HellgateKey:   "",
-		UsePatchDir:   flags.PatchDir,
-		PatchDir:      "",
+		Source:         dlutil.NewSources(client),
+		ChecksumURLs:   strutil.Fields(flags.ChecksumURL, ","),
+		PatchURLs:      strutil.Fields(flags.PatchURL, ","),
+		ChecksumFile:   checksumFile(),
+		MirrorStrategy: dlutil.MirrorStrategy(flags.MirrorStrategy),
+		PublicKey:      key,
+		HellgateCUKey:  "",
+		HellgateKey:    "",
+		InstallDir:     flags.InstallDir,
+		UsePatchDir:    flags.PatchDir,
+		PatchDir:       "",
+		Jobs:           flags.Jobs,
+		ShowProgress:   flags.Progress && logutil.IsTerminal(os.Stdout),
+		KeepBackups:    flags.KeepBackups,
+		Force:          flags.Force,
+		KeepGoing:      flags.KeepGoing,
+		Rehash:         flags.Rehash,
+		Report:         report.downloadReport(),
 	})
 
-	if err := downloadCmd(p); err != nil {
-		logutil.Errorf(logutil.Get(), "%w\n", err)
+	cmd, err := commands(ctx, p)
+	if cmd || err != nil {
+		return err
 	}
+
+	return downloadCmd(ctx, p)
+}
+
+// checksumFile returns the path of the checksum file, relative to the install
+// directory unless it is absolute.
+func checksumFile() string {
+	if filepath.IsAbs(flags.ChecksumFile) {
+		return flags.ChecksumFile
+	}
+
+	return filepath.Join(flags.InstallDir, flags.ChecksumFile)
+}
+
+// rateLimit sets up the rate limiter of the client from the flags.
+func rateLimit(ctx context.Context, client *dlutil.HTTPClient) error {
+	rate, err := strutil.ParseSize(flags.LimitRate)
+	if err != nil {
+		return errutil.New("strutil.ParseSize", err)
+	}
+
+	if rate <= 0 && flags.LimitRateFile == "" {
+		return nil
+	}
+
+	client.Limiter = dlutil.NewRateLimiter(rate)
+
+	if flags.LimitRateFile != "" {
+		go client.Limiter.WatchFile(ctx, flags.LimitRateFile, 2*time.Second)
+	}
+
+	return nil
+}
+
+// exit exits with code 2 if an update is needed, otherwise logs the error and exits with code 1.
+func exit(err error) {
+	if errors.Is(err, patcher.ErrUpdateNeeded) {
+		os.Exit(2)
+	}
+
+	if se := (*fsutil.SpaceError)(nil); errors.As(err, &se) {
+		logutil.Errorf(logutil.Get(), "%v, free up space or use -force to continue anyway\n", se)
+	}
+
+	logutil.Errorf(logutil.Get(), "Error running command: %v\n", err)
+	os.Exit(1)
 }
 
 // commands handles the specified command flags.
-func commands() (bool, error) {
+func commands(ctx context.Context, p *patcher.Context) (bool, error) {
 	args := flag.Args()
 	if len(args) == 0 {
 		return false, nil
@@ -82,12 +179,42 @@ func commands() (bool, error) {
 		Registry: lr,
 		Filter:   lf,
 		IdxOptions: &patchutil.IdxOptions{
-			CRC32: flags.CRC32,
+			Debug:       flags.Debug,
+			CRC32:       flags.CRC32,
+			StrictPaths: flags.StrictPaths,
+			Force:       flags.Force,
+			KeepGoing:   flags.KeepGoing,
+			Report:      report.patchReport(),
 		},
 		Archs: strutil.ToSlice(flags.Archs, ","),
 	}
 
 	switch cmd {
+	case "check":
+		return true, checkCmd(ctx, p)
+	case "verify":
+		return true, verifyCmd(ctx, p)
+	case "repair":
+		return true, repairCmd(ctx, p)
+	case "mirror":
+		cmds.Check(1)
+		return true, mirrorCmd(ctx, p, rest...)
+	case "prune":
+		return true, pruneCmd(ctx, p)
+	case "rollback":
+		return true, rollbackCmd(p, rest...)
+	case "genmanifest":
+		cmds.Check(2)
+		return true, genManifestCmd(ctx, rest...)
+	case "genkey":
+		cmds.Check(1)
+		return true, genKeyCmd(rest...)
+	case "sign-manifest":
+		cmds.Check(2)
+		return true, signManifestCmd(rest...)
+	case "serve":
+		cmds.Check(1)
+		return true, serveCmd(ctx, rest...)
 	case "decodeidx":
 		cmds.Check(2)
 		return true, decodeCmd(rest...)
@@ -96,16 +223,16 @@ func commands() (bool, error) {
 		return true, encodeCmd(rest...)
 	case "unpack":
 		cmds.Check(3)
-		return true, unpackCmd(o, rest...)
+		return true, unpackCmd(ctx, o, rest...)
 	case "pack":
 		cmds.Check(3)
-		return true, packCmd(o, rest...)
+		return true, packCmd(ctx, o, rest...)
 	case "packwithidx":
 		cmds.Check(3)
-		return true, packWithIdxCmd(o, rest...)
+		return true, packWithIdxCmd(ctx, o, rest...)
 	case "unpackfromfile":
 		cmds.Check(2)
-		return true, unpackFromFileCmd(o, rest...)
+		return true, unpackFromFileCmd(ctx, o, rest...)
 	case "regedit":
 		cmds.Check(2)
 		cmdutil.Supports("windows")
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"time"
+
+	"github.com/ricochhet/london2038patcher/cmd/london2038patcher/internal/patcher"
+	"github.com/ricochhet/london2038patcher/cmd/london2038patcher/internal/patchutil"
+	"github.com/ricochhet/london2038patcher/pkg/errutil"
+	"github.com/ricochhet/london2038patcher/pkg/jsonutil"
+	"github.com/ricochhet/london2038patcher/pkg/logutil"
+)
+
+type runReport struct {
+	Command  string            `json:"command"`
+	Args     []string          `json:"args"`
+	Started  string            `json:"started"`
+	Finished string            `json:"finished"`
+	Seconds  float64           `json:"seconds"`
+	Success  bool              `json:"success"`
+	Error    string            `json:"error,omitempty"`
+	Timings  []timing          `json:"timings"`
+	Download *patcher.Report   `json:"download"`
+	Patch    *patchutil.Report `json:"patch"`
+
+	start time.Time
+}
+
+type timing struct {
+	Name    string  `json:"name"`
+	Elapsed string  `json:"elapsed"`
+	Seconds float64 `json:"seconds"`
+}
+
+// report is the report of this run, nil unless -report is set.
+var report *runReport
+
+// newRunReport returns a runReport for the command, or nil if -report is not set.
+func newRunReport() *runReport {
+	if flags.Report == "" {
+		return nil
+	}
+
+	cmd, args := "download", []string{}
+	if a := flag.Args(); len(a) > 0 {
+		cmd, args = strings.ToLower(a[0]), a[1:]
+	}
+
+	now := time.Now()
+
+	return &runReport{
+		Command:  cmd,
+		Args:     args,
+		Started:  now.Format(time.RFC3339),
+		Timings:  []timing{},
+		Download: patcher.NewReport(),
+		Patch:    patchutil.NewReport(),
+		start:    now,
+	}
+}
+
+// took logs the elapsed time of a timeutil.Timer and adds it to the report.
+func took(name, elapsed string) {
+	logutil.Infof(logutil.Get(), "Took %s\n", elapsed)
+
+	if report == nil {
+		return
+	}
+
+	d, _ := time.ParseDuration(elapsed)
+	report.Timings = append(report.Timings, timing{Name: name, Elapsed: elapsed, Seconds: d.Seconds()})
+}
+
+// downloadReport returns the download report, or nil if there is no report.
+func (r *runReport) downloadReport() *patcher.Report {
+	if r == nil {
+		return nil
+	}
+
+	return r.Download
+}
+
+// patchReport returns the pack and unpack report, or nil if there is no report.
+func (r *runReport) patchReport() *patchutil.Report {
+	if r == nil {
+		return nil
+	}
+
+	return r.Patch
+}
+
+// write writes the report with the result of the run to the -report path.
+func (r *runReport) write(err error) error {
+	if r == nil {
+		return nil
+	}
+
+	now := time.Now()
+
+	r.Finished = now.Format(time.RFC3339)
+	r.Seconds = now.Sub(r.start).Seconds()
+	r.Success = err == nil
+
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	if _, err := jsonutil.MarshalAndWrite(flags.Report, r); err != nil {
+		return errutil.New("jsonutil.MarshalAndWrite", err)
+	}
+
+	return nil
+}
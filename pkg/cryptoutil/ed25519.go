@@ -0,0 +1,54 @@
+package cryptoutil
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// GenerateEd25519 returns a new base64 encoded ed25519 public and private key.
+func GenerateEd25519() (string, string, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+
+	return EncodeB64(pub), EncodeB64(priv), nil
+}
+
+// SignEd25519 signs data with the base64 encoded private key and returns the base64
+// encoded signature.
+func SignEd25519(privateKey string, data []byte) (string, error) {
+	priv, err := DecodeB64(strings.TrimSpace(privateKey))
+	if err != nil {
+		return "", err
+	}
+
+	if len(priv) != ed25519.PrivateKeySize {
+		return "", fmt.Errorf("invalid private key size %d", len(priv))
+	}
+
+	return EncodeB64(ed25519.Sign(ed25519.PrivateKey(priv), data)), nil
+}
+
+// VerifyEd25519 verifies the base64 encoded signature of data with the public key.
+func VerifyEd25519(pub ed25519.PublicKey, data []byte, signature string) error {
+	if len(pub) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid public key size %d", len(pub))
+	}
+
+	sig, err := DecodeB64(strings.TrimSpace(signature))
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(pub, data, sig) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
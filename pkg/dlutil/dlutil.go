@@ -2,16 +2,61 @@ package dlutil
 
 import (
 	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"hash"
 	"io"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/ricochhet/london2038patcher/pkg/errutil"
+	"github.com/ricochhet/london2038patcher/pkg/fsutil"
+	"github.com/ricochhet/london2038patcher/pkg/httputil"
+	"github.com/ricochhet/london2038patcher/pkg/logutil"
 )
 
 type HTTPClient struct {
 	*http.Client
+
+	Retry    RetryPolicy
+	Progress ProgressReporter
+	Limiter  *RateLimiter
+}
+
+type ProgressReporter interface {
+	// Progress is called with the bytes of path written so far and the total
+	// size, which is negative if unknown.
+	Progress(path string, read, total int64)
+}
+
+type progressReader struct {
+	io.Reader
+
+	path     string
+	read     int64
+	total    int64
+	reporter ProgressReporter
+}
+
+type Checksum struct {
+	MD5  string // Expected MD5 hash, not checked if empty.
+	Size int64  // Expected size in bytes, not checked if not positive.
+}
+
+type Conditional struct {
+	ETag         string // Sent as If-None-Match and updated from the response.
+	LastModified string // Sent as If-Modified-Since and updated from the response.
+	NotModified  bool   // Set if the server responded with 304 Not Modified.
+}
+
+type ChecksumError struct {
+	Path     string
+	Kind     string
+	Expected string
+	Actual   string
 }
 
 // NewHTTPClient returns a HttpClient struct.
@@ -23,32 +68,148 @@ func NewHTTPClient(timeout time.Duration) *HTTPClient {
 	}
 }
 
-// Download downloads a file from a URL into the specified path.
+// SetProgress sets the progress reporter of the client.
+func (c *HTTPClient) SetProgress(reporter ProgressReporter) {
+	c.Progress = reporter
+}
+
+// Error returns the error message.
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("%s mismatch for %s: expected %s, got %s", e.Kind, e.Path, e.Expected, e.Actual)
+}
+
+// Download downloads a file from a URL into the specified path, retrying transient
+// failures according to the retry policy.
 func (c *HTTPClient) Download(ctx context.Context, path, url string) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	return c.DownloadChecked(ctx, path, url, Checksum{})
+}
+
+// DownloadChecked is the same as Download but verifies the downloaded file against sum
+// before moving it into place. A mismatching download is discarded and retried.
+func (c *HTTPClient) DownloadChecked(ctx context.Context, path, url string, sum Checksum) error {
+	return c.Retry.Do(ctx, url, func() error {
+		return c.download(ctx, path, url, sum, nil)
+	})
+}
+
+// DownloadConditional is the same as Download but only downloads the file if it
+// does not exist or the server reports it changed since cond was recorded.
+func (c *HTTPClient) DownloadConditional(
+	ctx context.Context,
+	path, url string,
+	cond *Conditional,
+) error {
+	return c.Retry.Do(ctx, url, func() error {
+		return c.download(ctx, path, url, Checksum{}, cond)
+	})
+}
+
+// download downloads a file from a URL into the specified path.
+// If a partial download exists it is resumed with a range request, falling back
+// to a full download if the server does not support ranges or the file changed.
+func (c *HTTPClient) download(
+	ctx context.Context,
+	path, url string,
+	sum Checksum,
+	cond *Conditional,
+) error {
+	tmp := path + ".tmp"
+
+	resp, offset, err := c.request(ctx, path, url, cond)
 	if err != nil {
-		return errutil.New("http.NewRequestWithContext", err)
+		return errutil.New("c.request", err)
 	}
 
-	resp, err := c.Do(req)
-	if err != nil {
-		return errutil.New("c.Do", err)
+	// The partial download no longer fits the file, so restart it once from the
+	// beginning. A second 416 is returned as a StatusError.
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0 {
+		resp.Body.Close()
+		discard(tmp)
+
+		logutil.Infof(logutil.Get(), "Restarting: %s (range not satisfiable)\n", path)
+
+		resp, offset, err = c.request(ctx, path, url, cond)
+		if err != nil {
+			return errutil.New("c.request", err)
+		}
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return errutil.WithFramef("HTTP error: %s", resp.Status)
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+
+	if cond != nil && resp.StatusCode == http.StatusNotModified {
+		cond.NotModified = true
+		return nil
 	}
 
-	tmp := path + ".tmp"
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if offset > 0 {
+			logutil.Infof(logutil.Get(), "Restarting: %s (server sent full file)\n", path)
+		}
+
+		offset = 0
+
+		if err := writeValidator(tmp, resp); err != nil {
+			return errutil.New("writeValidator", err)
+		}
+	case http.StatusPartialContent:
+		if start := rangeStart(resp); start != offset {
+			return errutil.WithFramef("unexpected content range start %d, want %d", start, offset)
+		}
+
+		logutil.Infof(logutil.Get(), "Resuming: %s at %d bytes\n", path, offset)
+
+		flag = os.O_WRONLY | os.O_APPEND
+	default:
+		return errutil.WithFrame(&StatusError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			RetryAfter: retryAfter(resp),
+		})
+	}
+
+	h := md5.New()
+	if offset > 0 {
+		if err := hashFile(h, tmp); err != nil {
+			return errutil.New("hashFile", err)
+		}
+	}
 
-	out, err := os.Create(tmp)
+	out, err := os.OpenFile(tmp, flag, 0o644)
 	if err != nil {
-		return errutil.New("os.Create", err)
+		return errutil.New("os.OpenFile", err)
 	}
 
-	if _, err := io.Copy(out, resp.Body); err != nil {
+	var body io.Reader = resp.Body
+	if c.Limiter != nil {
+		body = &limitedReader{Reader: body, ctx: ctx, limiter: c.Limiter}
+	}
+
+	if c.Progress != nil {
+		total := int64(-1)
+		if resp.ContentLength >= 0 {
+			total = offset + resp.ContentLength
+		}
+
+		body = &progressReader{
+			Reader:   body,
+			path:     path,
+			read:     offset,
+			total:    total,
+			reporter: c.Progress,
+		}
+	}
+
+	n, err := io.Copy(out, io.TeeReader(body, h))
+	if err != nil {
 		out.Close()
+
+		// Keep the partial download on cancellation only if it can be resumed.
+		if ctx.Err() != nil && !fsutil.Exists(validatorPath(tmp)) {
+			discard(tmp)
+		}
+
 		return errutil.New("io.Copy", err)
 	}
 
@@ -56,5 +217,170 @@ func (c *HTTPClient) Download(ctx context.Context, path, url string) error {
 		return errutil.New("out.Close", err)
 	}
 
-	return os.Rename(tmp, path)
+	if err := sum.verify(path, offset+n, h); err != nil {
+		discard(tmp)
+		return errutil.WithFrame(err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return errutil.New("os.Rename", err)
+	}
+
+	_ = os.Remove(validatorPath(tmp))
+
+	if cond != nil {
+		cond.ETag = resp.Header.Get(string(httputil.HeaderETag))
+		cond.LastModified = resp.Header.Get(string(httputil.HeaderLastModified))
+		cond.NotModified = false
+	}
+
+	return nil
+}
+
+// Read reads from the underlying reader and reports the progress.
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		r.read += int64(n)
+		r.reporter.Progress(r.path, r.read, r.total)
+	}
+
+	return n, err
+}
+
+// verify returns a ChecksumError if the size or hash do not match the checksum.
+func (sum Checksum) verify(path string, size int64, h hash.Hash) error {
+	if sum.Size > 0 && size != sum.Size {
+		return &ChecksumError{
+			Path:     path,
+			Kind:     "size",
+			Expected: fmt.Sprintf("%d bytes", sum.Size),
+			Actual:   fmt.Sprintf("%d bytes", size),
+		}
+	}
+
+	actual := strings.ToUpper(hex.EncodeToString(h.Sum(nil)))
+	if sum.MD5 != "" && actual != strings.ToUpper(sum.MD5) {
+		return &ChecksumError{
+			Path:     path,
+			Kind:     "md5",
+			Expected: strings.ToUpper(sum.MD5),
+			Actual:   actual,
+		}
+	}
+
+	return nil
+}
+
+// hashFile writes the contents of the file at path into h.
+func hashFile(h hash.Hash, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errutil.WithFrame(err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return errutil.WithFrame(err)
+	}
+
+	return nil
+}
+
+// request sends the request for url, resuming the partial download of path if
+// there is one, and returns the response and the offset it resumes at.
+func (c *HTTPClient) request(
+	ctx context.Context,
+	path, url string,
+	cond *Conditional,
+) (*http.Response, int64, error) {
+	offset, validator := partial(path + ".tmp")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, errutil.New("http.NewRequestWithContext", err)
+	}
+
+	if offset > 0 {
+		req.Header.Set(string(httputil.HeaderRange), fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set(string(httputil.HeaderIfRange), validator)
+	}
+
+	if cond != nil && fsutil.Exists(path) {
+		if cond.ETag != "" {
+			req.Header.Set(string(httputil.HeaderIfNoneMatch), cond.ETag)
+		}
+
+		if cond.LastModified != "" {
+			req.Header.Set(string(httputil.HeaderIfModifiedSince), cond.LastModified)
+		}
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, 0, errutil.New("c.Do", err)
+	}
+
+	return resp, offset, nil
+}
+
+// partial returns the size and validator of a resumable partial download.
+// A partial download without a validator cannot be resumed safely.
+func partial(tmp string) (int64, string) {
+	info, err := os.Stat(tmp)
+	if err != nil || info.Size() == 0 {
+		return 0, ""
+	}
+
+	b, err := os.ReadFile(validatorPath(tmp))
+	if err != nil {
+		return 0, ""
+	}
+
+	validator := strings.TrimSpace(string(b))
+	if validator == "" {
+		return 0, ""
+	}
+
+	return info.Size(), validator
+}
+
+// writeValidator stores the ETag, or Last-Modified, of the response next to tmp.
+func writeValidator(tmp string, resp *http.Response) error {
+	validator := resp.Header.Get(string(httputil.HeaderETag))
+	if validator == "" || strings.HasPrefix(validator, "W/") {
+		validator = resp.Header.Get(string(httputil.HeaderLastModified))
+	}
+
+	if validator == "" {
+		_ = os.Remove(validatorPath(tmp))
+		return nil
+	}
+
+	return fsutil.Write(validatorPath(tmp), []byte(validator))
+}
+
+// rangeStart returns the first byte position of the Content-Range header, or -1.
+func rangeStart(resp *http.Response) int64 {
+	var start, end, size int64
+
+	cr := resp.Header.Get(string(httputil.HeaderContentRange))
+	if _, err := fmt.Sscanf(cr, "bytes %d-%d/%d", &start, &end, &size); err != nil {
+		if _, err := fmt.Sscanf(cr, "bytes %d-%d/*", &start, &end); err != nil {
+			return -1
+		}
+	}
+
+	return start
+}
+
+// discard removes a partial download and its validator.
+func discard(tmp string) {
+	_ = os.Remove(tmp)
+	_ = os.Remove(validatorPath(tmp))
+}
+
+// validatorPath returns the path of the validator file for tmp.
+func validatorPath(tmp string) string {
+	return tmp + ".etag"
 }
@@ -0,0 +1,157 @@
+package dlutil
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ricochhet/london2038patcher/pkg/errutil"
+	"github.com/ricochhet/london2038patcher/pkg/fsutil"
+)
+
+// FileSource is a Source that copies files from file:// URLs and plain paths.
+type FileSource struct {
+	Progress ProgressReporter
+}
+
+type contextReader struct {
+	io.Reader
+
+	ctx context.Context //nolint:containedctx // checked on every read of the copy.
+}
+
+// DownloadChecked copies the file at url into path and verifies it against sum.
+func (s *FileSource) DownloadChecked(ctx context.Context, path, url string, sum Checksum) error {
+	src, ok := LocalPath(url)
+	if !ok {
+		return errutil.WithFramef("not a local path: %s", url)
+	}
+
+	return s.copy(ctx, path, src, sum)
+}
+
+// DownloadConditional copies the file at url into path only if path does not
+// exist or the size or modification time of the file changed since cond was recorded.
+func (s *FileSource) DownloadConditional(
+	ctx context.Context,
+	path, url string,
+	cond *Conditional,
+) error {
+	src, ok := LocalPath(url)
+	if !ok {
+		return errutil.WithFramef("not a local path: %s", url)
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return errutil.WithFrame(err)
+	}
+
+	etag := fmt.Sprintf("\"%x-%x\"", info.ModTime().UnixNano(), info.Size())
+
+	if cond.ETag == etag && fsutil.Exists(path) {
+		cond.NotModified = true
+		return nil
+	}
+
+	if err := s.copy(ctx, path, src, Checksum{}); err != nil {
+		return errutil.WithFrame(err)
+	}
+
+	cond.ETag = etag
+	cond.LastModified = info.ModTime().UTC().Format(http.TimeFormat)
+	cond.NotModified = false
+
+	return nil
+}
+
+// Probe returns the time it takes to stat the file at url, or -1 if it fails.
+func (s *FileSource) Probe(_ context.Context, url string) time.Duration {
+	src, ok := LocalPath(url)
+	if !ok {
+		return -1
+	}
+
+	start := time.Now()
+
+	if _, err := os.Stat(src); err != nil {
+		return -1
+	}
+
+	return time.Since(start)
+}
+
+// SetProgress sets the progress reporter of the source.
+func (s *FileSource) SetProgress(reporter ProgressReporter) {
+	s.Progress = reporter
+}
+
+// copy copies the file at src into path through a temporary file, verifying it
+// against sum before moving it into place.
+func (s *FileSource) copy(ctx context.Context, path, src string, sum Checksum) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return errutil.WithFrame(err)
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return errutil.WithFrame(err)
+	}
+
+	tmp := path + ".tmp"
+
+	out, err := os.Create(tmp)
+	if err != nil {
+		return errutil.New("os.Create", err)
+	}
+
+	var body io.Reader = &contextReader{Reader: in, ctx: ctx}
+	if s.Progress != nil {
+		body = &progressReader{
+			Reader:   body,
+			path:     path,
+			total:    info.Size(),
+			reporter: s.Progress,
+		}
+	}
+
+	h := md5.New()
+
+	n, err := io.Copy(out, io.TeeReader(body, h))
+	if err != nil {
+		out.Close()
+		discard(tmp)
+
+		return errutil.New("io.Copy", err)
+	}
+
+	if err := out.Close(); err != nil {
+		return errutil.New("out.Close", err)
+	}
+
+	if err := sum.verify(path, n, h); err != nil {
+		discard(tmp)
+		return errutil.WithFrame(err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return errutil.New("os.Rename", err)
+	}
+
+	return nil
+}
+
+// Read returns the context error if it is done, otherwise reads from the underlying reader.
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return r.Reader.Read(p)
+}
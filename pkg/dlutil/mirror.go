@@ -0,0 +1,155 @@
+package dlutil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ricochhet/london2038patcher/pkg/errutil"
+	"github.com/ricochhet/london2038patcher/pkg/logutil"
+)
+
+type MirrorStrategy string
+
+const (
+	MirrorOrdered MirrorStrategy = "ordered"
+	MirrorFastest MirrorStrategy = "fastest"
+)
+
+// SortMirrors returns the URLs ordered according to the strategy. The fastest
+// strategy probes every URL and orders them by response time, with unreachable
+// URLs last.
+func SortMirrors(
+	ctx context.Context,
+	src Source,
+	urls []string,
+	strategy MirrorStrategy,
+) []string {
+	if strategy != MirrorFastest || len(urls) < 2 {
+		return urls
+	}
+
+	latency := make([]time.Duration, len(urls))
+
+	var wg sync.WaitGroup
+
+	for i, url := range urls {
+		wg.Go(func() {
+			latency[i] = src.Probe(ctx, url)
+		})
+	}
+
+	wg.Wait()
+
+	indices := make([]int, len(urls))
+	for i := range indices {
+		indices[i] = i
+	}
+
+	slices.SortStableFunc(indices, func(a, b int) int {
+		la, lb := latency[a], latency[b]
+
+		switch {
+		case la == lb:
+			return 0
+		case la < 0:
+			return 1
+		case lb < 0:
+			return -1
+		case la < lb:
+			return -1
+		default:
+			return 1
+		}
+	})
+
+	sorted := make([]string, 0, len(urls))
+	for _, i := range indices {
+		logutil.Debugf(logutil.Get(), "Mirror: %s (%s)\n", urls[i], latency[i])
+		sorted = append(sorted, urls[i])
+	}
+
+	return sorted
+}
+
+// DownloadMirrors downloads from each URL in turn until one succeeds, verifying
+// every download against sum.
+func DownloadMirrors(
+	ctx context.Context,
+	src Source,
+	path string,
+	urls []string,
+	sum Checksum,
+) error {
+	return downloadMirrors(ctx, path, urls, func(url string) error {
+		return src.DownloadChecked(ctx, path, url, sum)
+	})
+}
+
+// DownloadMirrorsConditional is the same as DownloadMirrors but performs a conditional
+// download with cond.
+func DownloadMirrorsConditional(
+	ctx context.Context,
+	src Source,
+	path string,
+	urls []string,
+	cond *Conditional,
+) error {
+	return downloadMirrors(ctx, path, urls, func(url string) error {
+		return src.DownloadConditional(ctx, path, url, cond)
+	})
+}
+
+// downloadMirrors calls fn with each URL in turn until one succeeds.
+func downloadMirrors(ctx context.Context, path string, urls []string, fn func(string) error) error {
+	if len(urls) == 0 {
+		return errutil.WithFramef("no URLs to download %s from", path)
+	}
+
+	var errs []error
+
+	for i, url := range urls {
+		err := fn(url)
+		if err == nil {
+			return nil
+		}
+
+		errs = append(errs, err)
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		if i < len(urls)-1 {
+			logutil.Warnf(logutil.Get(), "Mirror failed: %s, trying next: %v\n", url, err)
+		}
+	}
+
+	return errutil.WithFrame(errors.Join(errs...))
+}
+
+// Probe returns the response time of a HEAD request to url, or -1 if it fails.
+func (c *HTTPClient) Probe(ctx context.Context, url string) time.Duration {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return -1
+	}
+
+	start := time.Now()
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return -1
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return -1
+	}
+
+	return time.Since(start)
+}
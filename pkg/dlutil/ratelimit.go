@@ -0,0 +1,138 @@
+package dlutil
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ricochhet/london2038patcher/pkg/logutil"
+	"github.com/ricochhet/london2038patcher/pkg/strutil"
+	"github.com/sasha-s/go-deadlock"
+)
+
+type RateLimiter struct {
+	mu     deadlock.Mutex
+	rate   int64 // Bytes per second, unlimited if not positive.
+	tokens float64
+	last   time.Time
+}
+
+type limitedReader struct {
+	io.Reader
+
+	ctx     context.Context //nolint:containedctx // scoped to a single response body
+	limiter *RateLimiter
+}
+
+// NewRateLimiter returns a token bucket RateLimiter allowing rate bytes per second.
+// It is shared by all downloads using it.
+func NewRateLimiter(rate int64) *RateLimiter {
+	return &RateLimiter{rate: rate, last: time.Now()}
+}
+
+// Rate returns the rate in bytes per second.
+func (l *RateLimiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.rate
+}
+
+// SetRate sets the rate in bytes per second, taking effect immediately.
+func (l *RateLimiter) SetRate(rate int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rate = rate
+	l.tokens = 0
+	l.last = time.Now()
+}
+
+// WaitN takes n bytes from the bucket, waiting until they are available.
+func (l *RateLimiter) WaitN(ctx context.Context, n int) error {
+	l.mu.Lock()
+
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+
+	now := time.Now()
+	burst := float64(l.rate)
+
+	l.tokens = min(burst, l.tokens+now.Sub(l.last).Seconds()*float64(l.rate))
+	l.last = now
+	l.tokens -= float64(n)
+
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+	}
+
+	l.mu.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+
+	return sleep(ctx, wait)
+}
+
+// WatchFile polls the file at path and applies the rate it contains whenever it
+// changes, until the context is done.
+func (l *RateLimiter) WatchFile(ctx context.Context, path string, interval time.Duration) {
+	var mod time.Time
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		if info, err := os.Stat(path); err == nil && !info.ModTime().Equal(mod) {
+			mod = info.ModTime()
+			l.load(path)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// load reads the rate from the file at path.
+func (l *RateLimiter) load(path string) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	rate, err := strutil.ParseSize(strings.TrimSpace(string(b)))
+	if err != nil {
+		logutil.Warnf(logutil.Get(), "Invalid rate limit in %s: %v\n", path, err)
+		return
+	}
+
+	if rate != l.Rate() {
+		logutil.Infof(logutil.Get(), "Rate limit set to %s/s\n", strutil.Size(rate))
+		l.SetRate(rate)
+	}
+}
+
+// Read reads at most a tenth of a second's worth of bytes and waits for them.
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if rate := r.limiter.Rate(); rate > 0 {
+		p = p[:min(int64(len(p)), max(rate/10, 1))]
+	}
+
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		if err := r.limiter.WaitN(r.ctx, n); err != nil {
+			return n, err
+		}
+	}
+
+	return n, err
+}
@@ -0,0 +1,174 @@
+package dlutil
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ricochhet/london2038patcher/pkg/errutil"
+	"github.com/ricochhet/london2038patcher/pkg/httputil"
+	"github.com/ricochhet/london2038patcher/pkg/logutil"
+)
+
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Jitter      float64 // Fraction of the delay to randomize by, between 0 and 1.
+}
+
+type StatusError struct {
+	StatusCode int
+	Status     string
+	RetryAfter time.Duration
+}
+
+// DefaultRetryPolicy returns a RetryPolicy with the specified attempts and base delay.
+func DefaultRetryPolicy(attempts int, delay time.Duration) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: attempts,
+		BaseDelay:   delay,
+		MaxDelay:    30 * time.Second,
+		Jitter:      0.2,
+	}
+}
+
+// Error returns the error message.
+func (e *StatusError) Error() string {
+	return "HTTP error: " + e.Status
+}
+
+// Temporary returns true if the status code may succeed when retried.
+func (e *StatusError) Temporary() bool {
+	return e.StatusCode >= http.StatusInternalServerError ||
+		e.StatusCode == http.StatusRequestTimeout ||
+		e.StatusCode == http.StatusTooManyRequests
+}
+
+// Do runs fn until it succeeds, fails with a permanent error, or the attempts are exhausted.
+func (p RetryPolicy) Do(ctx context.Context, name string, fn func() error) error {
+	attempts := max(p.MaxAttempts, 1)
+
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= attempts || !retryable(ctx, err) {
+			return err
+		}
+
+		delay := p.delay(attempt)
+
+		var se *StatusError
+		if errors.As(err, &se) && se.RetryAfter > delay {
+			delay = se.RetryAfter
+
+			if p.MaxDelay > 0 && delay > p.MaxDelay {
+				logutil.Warnf(
+					logutil.Get(),
+					"Retry-After of %s for %s exceeds maximum delay, waiting %s\n",
+					se.RetryAfter,
+					name,
+					p.MaxDelay,
+				)
+
+				delay = p.MaxDelay
+			}
+		}
+
+		logutil.Warnf(
+			logutil.Get(),
+			"Retrying: %s in %s (attempt %d/%d): %v\n",
+			name,
+			delay.Round(time.Millisecond),
+			attempt+1,
+			attempts,
+			err,
+		)
+
+		if err := sleep(ctx, delay); err != nil {
+			return errutil.WithFrame(err)
+		}
+	}
+}
+
+// delay returns the exponential backoff delay before the next attempt, with jitter applied.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay << (attempt - 1)
+	if d <= 0 || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay
+	}
+
+	if p.Jitter > 0 {
+		d += time.Duration(float64(d) * p.Jitter * (2*rand.Float64() - 1))
+	}
+
+	return max(d, 0)
+}
+
+// retryable returns true if the error is transient.
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Temporary()
+	}
+
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return false
+	}
+
+	var ue *url.Error
+	if errors.As(err, &ue) && ue.Op == "parse" {
+		return false
+	}
+
+	var ce *tls.CertificateVerificationError
+	if errors.As(err, &ce) {
+		return false
+	}
+
+	return true
+}
+
+// retryAfter parses the Retry-After header as either seconds or an HTTP date.
+func retryAfter(resp *http.Response) time.Duration {
+	v := resp.Header.Get(string(httputil.HeaderRetryAfter))
+	if v == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0)
+	}
+
+	return 0
+}
+
+// sleep waits for d or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("retry canceled: %w", context.Cause(ctx))
+	}
+}
@@ -0,0 +1,105 @@
+package dlutil
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Source downloads files from URLs into local paths.
+type Source interface {
+	// DownloadChecked downloads url into path and verifies it against sum.
+	DownloadChecked(ctx context.Context, path, url string, sum Checksum) error
+	// DownloadConditional downloads url into path only if it changed since cond was recorded.
+	DownloadConditional(ctx context.Context, path, url string, cond *Conditional) error
+	// Probe returns the response time of url, or -1 if it is unreachable.
+	Probe(ctx context.Context, url string) time.Duration
+	// SetProgress sets the progress reporter of the source.
+	SetProgress(reporter ProgressReporter)
+}
+
+// Sources is a Source that downloads local URLs with Local and all others with HTTP.
+type Sources struct {
+	HTTP  Source
+	Local Source
+}
+
+// NewSources returns a Sources struct that downloads with client and copies local files.
+func NewSources(client *HTTPClient) *Sources {
+	return &Sources{
+		HTTP:  client,
+		Local: &FileSource{},
+	}
+}
+
+// DownloadChecked downloads url into path with the source for url.
+func (s *Sources) DownloadChecked(ctx context.Context, path, url string, sum Checksum) error {
+	return s.source(url).DownloadChecked(ctx, path, url, sum)
+}
+
+// DownloadConditional downloads url into path with the source for url.
+func (s *Sources) DownloadConditional(
+	ctx context.Context,
+	path, url string,
+	cond *Conditional,
+) error {
+	return s.source(url).DownloadConditional(ctx, path, url, cond)
+}
+
+// Probe probes url with the source for url.
+func (s *Sources) Probe(ctx context.Context, url string) time.Duration {
+	return s.source(url).Probe(ctx, url)
+}
+
+// SetProgress sets the progress reporter of every source.
+func (s *Sources) SetProgress(reporter ProgressReporter) {
+	s.HTTP.SetProgress(reporter)
+	s.Local.SetProgress(reporter)
+}
+
+// source returns the source for url.
+func (s *Sources) source(url string) Source {
+	if _, ok := LocalPath(url); ok {
+		return s.Local
+	}
+
+	return s.HTTP
+}
+
+// LocalPath returns the local path of a file:// URL or plain path, and false
+// for any other URL.
+func LocalPath(raw string) (string, bool) {
+	rest, ok := strings.CutPrefix(raw, "file://")
+	if !ok {
+		if strings.Contains(raw, "://") {
+			return "", false
+		}
+
+		return filepath.FromSlash(raw), true
+	}
+
+	if unescaped, err := url.PathUnescape(rest); err == nil {
+		rest = unescaped
+	}
+
+	switch {
+	case isDrive(strings.TrimPrefix(rest, "/")):
+		// file:///C:/path and file://C:/path
+		rest = strings.TrimPrefix(rest, "/")
+	case strings.HasPrefix(rest, "localhost/"):
+		rest = strings.TrimPrefix(rest, "localhost")
+	case !strings.HasPrefix(rest, "/"):
+		// file://server/share/path
+		rest = "//" + rest
+	}
+
+	return filepath.FromSlash(rest), true
+}
+
+// isDrive reports whether path starts with a drive letter.
+func isDrive(path string) bool {
+	return len(path) >= 2 && path[1] == ':' &&
+		(('a' <= path[0] && path[0] <= 'z') || ('A' <= path[0] && path[0] <= 'Z'))
+}
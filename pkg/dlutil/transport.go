@@ -0,0 +1,121 @@
+package dlutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ricochhet/london2038patcher/pkg/errutil"
+)
+
+type ClientOptions struct {
+	Timeout   time.Duration
+	Proxy     string   // Proxy URL, the environment is used if empty.
+	CABundle  string   // Path to a PEM file of CA certificates trusted in addition to the system roots.
+	UserAgent string   // User-Agent header, the Go default is used if empty.
+	Headers   []string // Extra headers in "Key: Value" form.
+}
+
+type headerTransport struct {
+	base   http.RoundTripper
+	header http.Header
+}
+
+// NewHTTPClientFromOptions returns a HTTPClient configured with the options.
+func NewHTTPClientFromOptions(o *ClientOptions) (*HTTPClient, error) {
+	t, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return nil, errutil.WithFramef("unexpected default transport type %T", http.DefaultTransport)
+	}
+
+	t = t.Clone()
+
+	if o.Proxy != "" {
+		u, err := url.Parse(o.Proxy)
+		if err != nil {
+			return nil, errutil.New("url.Parse", err)
+		}
+
+		t.Proxy = http.ProxyURL(u)
+	}
+
+	if o.CABundle != "" {
+		pool, err := certPool(o.CABundle)
+		if err != nil {
+			return nil, errutil.New("certPool", err)
+		}
+
+		t.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	header, err := parseHeaders(o.Headers)
+	if err != nil {
+		return nil, errutil.New("parseHeaders", err)
+	}
+
+	if o.UserAgent != "" {
+		header.Set("User-Agent", o.UserAgent)
+	}
+
+	var rt http.RoundTripper = t
+	if len(header) > 0 {
+		rt = &headerTransport{base: t, header: header}
+	}
+
+	return &HTTPClient{
+		Client: &http.Client{
+			Timeout:   o.Timeout,
+			Transport: rt,
+		},
+	}, nil
+}
+
+// RoundTrip sets the headers on a copy of the request and sends it.
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+
+	for k, v := range t.header {
+		req.Header[k] = v
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// certPool returns the system certificate pool with the certificates in path added.
+func certPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errutil.New("os.ReadFile", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errutil.WithFramef("no certificates found in %s", path)
+	}
+
+	return pool, nil
+}
+
+// parseHeaders parses headers in "Key: Value" form.
+func parseHeaders(headers []string) (http.Header, error) {
+	h := http.Header{}
+
+	for _, header := range headers {
+		k, v, ok := strings.Cut(header, ":")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, errutil.WithFramef("invalid header %q, expected \"Key: Value\"", header)
+		}
+
+		h.Add(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+
+	return h, nil
+}
@@ -0,0 +1,116 @@
+package dlutil
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ricochhet/london2038patcher/pkg/logutil"
+)
+
+func TestMain(m *testing.M) {
+	logutil.Set(logutil.NewLogger("test", 0))
+	os.Exit(m.Run())
+}
+
+// newTLSServer returns a TLS server recording the headers of the last request,
+// and the path of a PEM file with its certificate.
+func newTLSServer(t *testing.T) (*httptest.Server, string, *http.Header) {
+	t.Helper()
+
+	var header http.Header
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(srv.Close)
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+
+	if err := os.WriteFile(bundle, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return srv, bundle, &header
+}
+
+func TestCABundle(t *testing.T) {
+	srv, bundle, _ := newTLSServer(t)
+
+	tests := []struct {
+		name     string
+		bundle   string
+		wantFail bool
+	}{
+		{name: "with bundle", bundle: bundle},
+		{name: "without bundle", wantFail: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewHTTPClientFromOptions(&ClientOptions{CABundle: tt.bundle})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join(t.TempDir(), "file")
+
+			err = client.Download(context.Background(), path, srv.URL+"/file")
+			if (err != nil) != tt.wantFail {
+				t.Fatalf("Download error = %v, want failure %v", err, tt.wantFail)
+			}
+
+			if tt.wantFail {
+				return
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(data) != "ok" {
+				t.Errorf("got %q, want %q", data, "ok")
+			}
+		})
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	srv, bundle, header := newTLSServer(t)
+
+	client, err := NewHTTPClientFromOptions(&ClientOptions{
+		CABundle:  bundle,
+		UserAgent: "London2038Patcher/test",
+		Headers:   []string{"X-Token: secret", "X-Mirror: eu"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Download(context.Background(), filepath.Join(t.TempDir(), "file"), srv.URL+"/file"); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+
+	for k, want := range map[string]string{
+		"User-Agent": "London2038Patcher/test",
+		"X-Token":    "secret",
+		"X-Mirror":   "eu",
+	} {
+		if got := header.Get(k); got != want {
+			t.Errorf("%s = %q, want %q", k, got, want)
+		}
+	}
+}
+
+func TestInvalidHeader(t *testing.T) {
+	if _, err := NewHTTPClientFromOptions(&ClientOptions{Headers: []string{"no colon"}}); err == nil {
+		t.Error("NewHTTPClientFromOptions succeeded with an invalid header")
+	}
+}
@@ -43,6 +43,16 @@ func Exists(path string) bool {
 	return !os.IsNotExist(err)
 }
 
+// Size returns the size of the file at path.
+func Size(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, errutil.WithFrame(err)
+	}
+
+	return info.Size(), nil
+}
+
 // Ensure ensures the file path, returning an error if it fails.
 func Ensure(path string) error {
 	dir := filepath.Dir(path)
@@ -53,21 +63,57 @@ func Ensure(path string) error {
 	return nil
 }
 
+// LinkOrCopy hard links the file at src to dst, copying it if the link fails, for
+// example because dst is on another volume.
+func LinkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return errutil.WithFrame(err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return errutil.WithFrame(err)
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		_ = os.Remove(dst)
+
+		return errutil.WithFrame(err)
+	}
+
+	return errutil.WithFrame(out.Close())
+}
+
 // Validate checks if a file exists and matches the given hash.
 func Validate(path, hash string, h hash.Hash) bool {
-	f, err := os.Open(path)
+	sum, err := HashFile(path, h)
 	if err != nil {
 		return false
 	}
+
+	return sum == strings.ToUpper(hash)
+}
+
+// HashFile returns the uppercase hex encoded hash of the file at path.
+func HashFile(path string, h hash.Hash) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errutil.WithFrame(err)
+	}
 	defer f.Close()
 
 	if _, err := io.Copy(h, f); err != nil {
-		return false
+		return "", errutil.WithFrame(err)
 	}
 
-	sum := strings.ToUpper(hex.EncodeToString(h.Sum(nil)))
-
-	return sum == strings.ToUpper(hash)
+	return strings.ToUpper(hex.EncodeToString(h.Sum(nil))), nil
 }
 
 // JoinEnviron combines the given envs with the env by name.
@@ -83,17 +129,23 @@ func JoinEnviron(name string, envs []string) string {
 	return name + "=" + n
 }
 
-// SafeJoin ensures the joined path does not escape base.
+// SafeJoin joins rel to base and returns the absolute path, ensuring it does not
+// escape base. Absolute and volume qualified rel paths are rejected.
 func SafeJoin(base, rel string) (string, error) {
-	joined := filepath.Join(base, rel)
+	if filepath.IsAbs(rel) || filepath.VolumeName(rel) != "" {
+		return "", fmt.Errorf("path %q is not relative", rel)
+	}
 
-	abs, err := filepath.Abs(joined)
+	root, err := filepath.Abs(base)
 	if err != nil {
 		return "", err
 	}
 
-	if abs != base && !strings.HasPrefix(abs, base+string(filepath.Separator)) {
-		return "", fmt.Errorf("path %q escapes base %q", abs, base)
+	abs := filepath.Join(root, rel)
+
+	r, err := filepath.Rel(root, abs)
+	if err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q escapes base %q", rel, base)
 	}
 
 	return abs, nil
@@ -0,0 +1,163 @@
+package fsutil
+
+import (
+	"encoding/json"
+	"hash"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ricochhet/london2038patcher/pkg/errutil"
+	"github.com/sasha-s/go-deadlock"
+)
+
+// HashCache remembers the hashes of files by path, so files whose size and
+// modification time did not change are not hashed again. A cache holds hashes
+// of a single algorithm.
+type HashCache struct {
+	mu      deadlock.Mutex
+	path    string
+	entries map[string]hashEntry
+	dirty   bool
+
+	Rehash bool // Hashes every file instead of trusting cached hashes.
+}
+
+type hashEntry struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"modTime"` // Unix nanoseconds.
+	Hash    string `json:"hash"`
+}
+
+// LoadHashCache loads the hash cache at path, returning an empty cache if there is
+// none or it cannot be read.
+func LoadHashCache(path string) *HashCache {
+	c := &HashCache{path: path, entries: map[string]hashEntry{}}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c
+	}
+
+	if err := json.Unmarshal(data, &c.entries); err != nil || c.entries == nil {
+		c.entries = map[string]hashEntry{}
+	}
+
+	return c
+}
+
+// Validate is the same as Validate but trusts the cached hash of the file at path
+// if its size and modification time did not change since it was hashed. Calling
+// Validate on a nil HashCache hashes the file.
+func (c *HashCache) Validate(path, hash string, h hash.Hash) bool {
+	if c == nil {
+		return Validate(path, hash, h)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	key := cacheKey(path)
+
+	if !c.Rehash {
+		c.mu.Lock()
+		e, ok := c.entries[key]
+		c.mu.Unlock()
+
+		if ok && e.Size == info.Size() && e.ModTime == info.ModTime().UnixNano() {
+			return e.Hash == strings.ToUpper(hash)
+		}
+	}
+
+	sum, err := HashFile(path, h)
+	if err != nil {
+		return false
+	}
+
+	c.set(key, info, sum)
+
+	return sum == strings.ToUpper(hash)
+}
+
+// Unchanged returns true if the file at path exists and its size and modification
+// time did not change since it was recorded with hash, without hashing it.
+// Calling Unchanged on a nil HashCache, or with Rehash set, returns false.
+func (c *HashCache) Unchanged(path, hash string) bool {
+	if c == nil || c.Rehash {
+		return false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	c.mu.Lock()
+	e, ok := c.entries[cacheKey(path)]
+	c.mu.Unlock()
+
+	return ok && e.Size == info.Size() && e.ModTime == info.ModTime().UnixNano() &&
+		e.Hash == strings.ToUpper(hash)
+}
+
+// Update records hash as the hash of the file at path, for files that were
+// verified while being written.
+func (c *HashCache) Update(path, hash string) {
+	if c == nil {
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+
+	c.set(cacheKey(path), info, strings.ToUpper(hash))
+}
+
+// Save writes the hash cache if it changed since it was loaded.
+func (c *HashCache) Save() error {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(c.entries, "", "\t")
+	if err != nil {
+		return errutil.New("json.MarshalIndent", err)
+	}
+
+	if err := Write(c.path, data); err != nil {
+		return errutil.New("Write", err)
+	}
+
+	c.dirty = false
+
+	return nil
+}
+
+// set records the hash of the file with the given info.
+func (c *HashCache) set(key string, info os.FileInfo, hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = hashEntry{Size: info.Size(), ModTime: info.ModTime().UnixNano(), Hash: hash}
+	c.dirty = true
+}
+
+// cacheKey returns the absolute path of path, or path if it cannot be resolved.
+func cacheKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+
+	return path
+}
@@ -0,0 +1,78 @@
+package fsutil
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/ricochhet/london2038patcher/pkg/errutil"
+	"github.com/ricochhet/london2038patcher/pkg/strutil"
+)
+
+// SpaceMargin is the number of bytes CheckSpace keeps free in addition to 10% of
+// the space needed.
+const SpaceMargin = 64 << 20
+
+type SpaceError struct {
+	Path string
+	Need int64
+	Free int64
+}
+
+// Error returns the error message.
+func (e *SpaceError) Error() string {
+	return fmt.Sprintf(
+		"not enough disk space for %s: %s needed, %s free",
+		e.Path,
+		strutil.Size(e.Need),
+		strutil.Size(e.Free),
+	)
+}
+
+// FreeSpace returns the number of bytes available on the volume of path, using the
+// closest existing parent directory if path does not exist yet.
+func FreeSpace(path string) (int64, error) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return 0, errutil.New("filepath.Abs", err)
+	}
+
+	for !Exists(dir) {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+
+		dir = parent
+	}
+
+	free, err := freeSpace(dir)
+	if err != nil {
+		return 0, errutil.New("freeSpace", err)
+	}
+
+	return int64(min(free, 1<<63-1)), nil
+}
+
+// CheckSpace returns a SpaceError if the volume of path has less than need bytes
+// free, plus a safety margin.
+func CheckSpace(path string, need int64) error {
+	if need <= 0 {
+		return nil
+	}
+
+	free, err := FreeSpace(path)
+	if err != nil {
+		return errutil.New("FreeSpace", err)
+	}
+
+	need += need/10 + SpaceMargin
+	if free < need {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+
+		return errutil.WithFrame(&SpaceError{Path: path, Need: need, Free: free})
+	}
+
+	return nil
+}
@@ -17,6 +17,7 @@ const (
 	ContentTypeText        ContentTypeValue = "text/plain; charset=utf-8"
 	ContentTypeEventStream ContentTypeValue = "text/event-stream"
 	ContentTypeBinary      ContentTypeValue = "application/octet-stream"
+	ContentTypeXML         ContentTypeValue = "application/xml; charset=utf-8"
 )
 
 const (
@@ -28,6 +29,14 @@ const (
 	HeaderXFrameOptions       HeaderKey = "X-Frame-Options"
 	HeaderConnection          HeaderKey = "Connection"
 	HeaderXAccelBuffering     HeaderKey = "X-Accel-Buffering"
+	HeaderRange               HeaderKey = "Range"
+	HeaderIfRange             HeaderKey = "If-Range"
+	HeaderContentRange        HeaderKey = "Content-Range"
+	HeaderETag                HeaderKey = "Etag"
+	HeaderLastModified        HeaderKey = "Last-Modified"
+	HeaderRetryAfter          HeaderKey = "Retry-After"
+	HeaderIfNoneMatch         HeaderKey = "If-None-Match"
+	HeaderIfModifiedSince     HeaderKey = "If-Modified-Since"
 )
 
 // ContentType sets the Content-Type response header.
@@ -40,6 +49,15 @@ func SetHeader(w http.ResponseWriter, key HeaderKey, value string) {
 	w.Header().Set(string(key), value)
 }
 
+// ETag sets the ETag response header to the quoted value.
+func ETag(w http.ResponseWriter, value string) {
+	if value == "" {
+		return
+	}
+
+	w.Header().Set(string(HeaderETag), fmt.Sprintf("%q", value))
+}
+
 // ContentDispositionAttachment sets Content-Disposition to attachment with the given filename.
 func ContentDispositionAttachment(w http.ResponseWriter, filename string) {
 	w.Header().
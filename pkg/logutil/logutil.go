@@ -14,6 +14,7 @@ import (
 )
 
 type Logger struct {
+	mu      deadlock.Mutex // Serializes concurrent writers.
 	idx     int
 	name    string
 	writes  chan []byte
@@ -72,8 +73,11 @@ func (v *buffers) consume(n int64) {
 	}
 }
 
-// Write writes p.
+// Write writes p. It is safe for concurrent use.
 func (l *Logger) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	l.writes <- p
 
 	<-l.done
@@ -0,0 +1,139 @@
+package logutil
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/ricochhet/london2038patcher/pkg/strutil"
+	"github.com/sasha-s/go-deadlock"
+)
+
+type Progress struct {
+	mu       deadlock.Mutex
+	interval time.Duration
+	start    time.Time
+	last     time.Time
+	total    int64 // Expected bytes across all files.
+	done     int64 // Bytes completed across all files, including skipped files.
+	moved    int64 // Bytes transferred since start.
+	files    map[string]*fileProgress
+}
+
+type fileProgress struct {
+	start   time.Time
+	updated time.Time
+	first   int64
+	read    int64
+	total   int64
+}
+
+// NewProgress returns a Progress that renders at most once per interval.
+func NewProgress(total int64, interval time.Duration) *Progress {
+	now := time.Now()
+
+	return &Progress{
+		interval: interval,
+		start:    now,
+		last:     now,
+		total:    total,
+		files:    map[string]*fileProgress{},
+	}
+}
+
+// IsTerminal returns true if f is a character device.
+func IsTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Progress records that read of total bytes of path have been written. A negative
+// total means the size is unknown.
+func (p *Progress) Progress(path string, read, total int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+
+	fp, ok := p.files[path]
+	if !ok || read < fp.read {
+		// The file is new or the download restarted.
+		if ok {
+			p.done -= fp.read
+		}
+
+		fp = &fileProgress{start: now, first: read, read: read, total: total}
+		p.files[path] = fp
+		p.done += read
+	}
+
+	delta := read - fp.read
+	fp.read = read
+	fp.updated = now
+	p.done += delta
+	p.moved += delta
+
+	if now.Sub(p.last) >= p.interval {
+		p.render()
+		p.last = now
+	}
+}
+
+// Skip records n bytes as completed without being transferred.
+func (p *Progress) Skip(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done += n
+}
+
+// render prints a line for each file in progress followed by the overall progress.
+func (p *Progress) render() {
+	paths := make([]string, 0, len(p.files))
+
+	for path, fp := range p.files {
+		if (fp.total >= 0 && fp.read >= fp.total) || fp.updated.Before(p.last) {
+			continue
+		}
+
+		paths = append(paths, path)
+	}
+
+	slices.Sort(paths)
+
+	for _, path := range paths {
+		fp := p.files[path]
+		Infof(Get(), "Progress: %s %s\n", path, line(fp.read, fp.total, fp.read-fp.first, fp.start))
+	}
+
+	Infof(Get(), "Progress: total %s\n", line(p.done, p.total, p.moved, p.start))
+}
+
+// line formats the read bytes, percentage, rate and ETA.
+func line(read, total, moved int64, start time.Time) string {
+	rate := float64(moved) / max(time.Since(start).Seconds(), 0.001)
+
+	if total <= 0 {
+		return fmt.Sprintf("%s %s/s", strutil.Size(read), strutil.Size(int64(rate)))
+	}
+
+	eta := "unknown"
+	if rate > 0 {
+		secs := float64(max(total-read, 0)) / rate
+		eta = (time.Duration(secs) * time.Second).String()
+	}
+
+	return fmt.Sprintf(
+		"%s/%s (%.0f%%) %s/s ETA %s",
+		strutil.Size(read),
+		strutil.Size(total),
+		float64(read)/float64(total)*100,
+		strutil.Size(int64(rate)),
+		eta,
+	)
+}
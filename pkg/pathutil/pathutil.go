@@ -1,6 +1,8 @@
 package pathutil
 
 import (
+	"fmt"
+	"path"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -15,3 +17,52 @@ func Normalize(path string) string {
 
 	return clean
 }
+
+// SafeRel returns a slash or backslash separated relative name as a relative path
+// with the separators of the OS. Empty, absolute, drive qualified and escaping
+// names are rejected.
+func SafeRel(name string) (string, error) {
+	n := strings.ReplaceAll(name, "\\", "/")
+	clean := path.Clean(n)
+
+	switch {
+	case n == "" || clean == ".":
+		return "", fmt.Errorf("empty file name: %q", name)
+	case strings.HasPrefix(n, "/"):
+		return "", fmt.Errorf("absolute file name: %q", name)
+	case strings.Contains(n, ":"):
+		return "", fmt.Errorf("drive qualified file name: %q", name)
+	case clean == ".." || strings.HasPrefix(clean, "../"):
+		return "", fmt.Errorf("file name escapes its directory: %q", name)
+	}
+
+	return filepath.FromSlash(clean), nil
+}
+
+// Match returns true if the slash separated relative path matches any of the patterns.
+// Patterns without a slash match any single path element, so "*.ini" matches files
+// in every directory and "Screenshots" matches the directory and everything in it.
+// Patterns with a slash match the full path or any of its parent directories.
+func Match(patterns []string, rel string) bool {
+	elems := strings.Split(rel, "/")
+
+	for _, pattern := range patterns {
+		if !strings.Contains(pattern, "/") {
+			for _, elem := range elems {
+				if ok, _ := path.Match(pattern, elem); ok {
+					return true
+				}
+			}
+
+			continue
+		}
+
+		for i := range elems {
+			if ok, _ := path.Match(pattern, strings.Join(elems[:i+1], "/")); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -2,6 +2,7 @@ package strutil
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -10,6 +11,19 @@ func ToSlice(s, sep string) []string {
 	return strings.Split(s, sep)
 }
 
+// Fields splits s by the separator, trimming spaces and dropping empty fields.
+func Fields(s, sep string) []string {
+	var fields []string
+
+	for f := range strings.SplitSeq(s, sep) {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+
+	return fields
+}
+
 // Empty returns s if it's not empty, otherwise returns "<empty>".
 func Empty(s string) string {
 	if s != "" {
@@ -32,3 +46,34 @@ func Size(n int64) string {
 		return fmt.Sprintf("%.2f GB", float64(n)/(1024*1024*1024))
 	}
 }
+
+// ParseSize parses a size such as "512K", "2M" or "1.5G" into bytes. Suffixes are
+// powers of 1024, and an empty string or "0" means zero.
+func ParseSize(s string) (int64, error) {
+	s = strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	if s == "" {
+		return 0, nil
+	}
+
+	mult := 1.0
+
+	switch s[len(s)-1] {
+	case 'K':
+		mult = 1024
+	case 'M':
+		mult = 1024 * 1024
+	case 'G':
+		mult = 1024 * 1024 * 1024
+	}
+
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+
+	return int64(n * mult), nil
+}